@@ -1747,17 +1747,17 @@ func (api *PublicDebugAPI) Metrics(raw bool) (map[string]interface{}, error) {
 // Verbosity implements api method debug_verbosity, enabling setting
 // global logging verbosity on the fly.
 // Note that it will NOT allow setting verbosity '0', which is effectively 'off'.
-// In place of ability to receive 0 as a functional parameter, debug.verbosity() -> debug.verbosity(0) -> glog.GetVerbosity().
+// In place of ability to receive 0 as a functional parameter, debug.verbosity() -> debug.verbosity(0) -> glog.Verbosity().
 // creates a shorthand/convenience method as a "getter" function returning the current value
 // of the verbosity setting.
 func (api *PublicDebugAPI) Verbosity(n uint64) (int, error) {
 	nint := int(n)
 	if nint == 0 {
-		return int(*glog.GetVerbosity()), nil
+		return glog.Verbosity(), nil
 	}
 	if nint <= logger.Detail || nint == logger.Ridiculousness {
 		glog.SetV(nint)
-		return int(*glog.GetVerbosity()), nil
+		return glog.Verbosity(), nil
 	}
 	return -1, errors.New("invalid logging level")
 }
@@ -1768,7 +1768,7 @@ func (api *PublicDebugAPI) Vmodule(s string) (string, error) {
 	if s == "" {
 		return glog.GetVModule().String(), nil
 	}
-	err := glog.GetVModule().Set(s)
+	err := glog.SetVModule(s)
 	return glog.GetVModule().String(), err
 }
 
@@ -0,0 +1,45 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog_test
+
+import (
+	"fmt"
+
+	"github.com/ethereumproject/go-ethereum/logger/glog"
+)
+
+func ExampleMemorySink() {
+	// Keep the lines out of the log files and the headers short.
+	glog.SetToStderr(true)
+	defer glog.SetToStderr(false)
+	glog.SetHeaderParts(glog.HeaderSeverity)
+	defer glog.SetHeaderParts(glog.HeaderAll)
+
+	sink := glog.NewMemorySink()
+	glog.SetSink(glog.WarningSeverity, sink)
+	defer glog.SetSink(glog.WarningSeverity, nil)
+
+	glog.Info("not stored")
+	glog.Warning("disk almost full")
+	glog.Error("disk full")
+	for _, line := range sink.Lines() {
+		fmt.Println(line)
+	}
+	// Output:
+	// W disk almost full
+	// E disk full
+}
@@ -36,6 +36,8 @@
 // should call Flush before exiting to guarantee all log output is written.
 //
 // By default, all log statements write to files in a temporary directory.
+// DEBUG lines, and the DEBUG file, are only written once debug output is
+// enabled; see SetFileThreshold.
 // This package provides several flags that modify this behavior.
 // As a result, flag.Parse must be called before any logging is done.
 //
@@ -93,26 +95,143 @@ import (
 	"time"
 )
 
-// severity identifies the sort of log: info, warning etc. It also implements
-// the flag.Value interface. The -stderrthreshold flag is of type severity and
+// Severity identifies the sort of log: info, warning etc. It also implements
+// the flag.Value interface. The -stderrthreshold flag is of type Severity and
 // should be modified only through the flag.Value interface. The values match
-// the corresponding constants in C++.
-type severity int32 // sync/atomic int32
+// the corresponding constants in C++ plus one, to make room for debugLog.
+type Severity int32 // sync/atomic int32
 
 // These constants identify the log levels in order of increasing severity.
 // A message written to a high-severity log file is also written to each
 // lower-severity log file.
 const (
-	infoLog severity = iota
+	debugLog Severity = iota
+	infoLog
 	warningLog
 	errorLog
 	fatalLog
-	numSeverity = 4
+	numSeverity = 5
 )
 
-const severityChar = "IWEF"
+// Exported severities, for use with the configuration functions below.
+const (
+	DebugSeverity   = debugLog
+	InfoSeverity    = infoLog
+	WarningSeverity = warningLog
+	ErrorSeverity   = errorLog
+	FatalSeverity   = fatalLog
+)
+
+// severityStyle describes how a severity is marked at the start of a header.
+type severityStyle struct {
+	char  byte   // single-letter prefix, e.g. 'I'
+	color string // ANSI escape sequence written before char; empty for none
+}
+
+// severityColorReset ends the color sequence of a severityStyle.
+const severityColorReset = "\x1b[0m"
+
+// severityStyles holds the header style of each severity. It is guarded
+// by severityStylesMu since headers are formatted without logging.mu held.
+var (
+	severityStylesMu sync.RWMutex
+	severityStyles   = [numSeverity]severityStyle{
+		debugLog:   {char: 'D'},
+		infoLog:    {char: 'I'},
+		warningLog: {char: 'W'},
+		errorLog:   {char: 'E'},
+		fatalLog:   {char: 'F'},
+	}
+)
+
+// SetSeverityStyle remaps the single-letter header prefix of severity s
+// to char and colors it with the given ANSI escape sequence. An empty color
+// disables coloring for s.
+func SetSeverityStyle(s Severity, char string, color string) error {
+	if s < debugLog || s > fatalLog {
+		return fmt.Errorf("glog: invalid severity %d", s)
+	}
+	if len(char) != 1 {
+		return fmt.Errorf("glog: severity character must be a single byte, got %q", char)
+	}
+	severityStylesMu.Lock()
+	severityStyles[s] = severityStyle{char: char[0], color: color}
+	severityStylesMu.Unlock()
+	return nil
+}
+
+// ColorMode selects whether severity colors are written.
+type ColorMode uint32
+
+const (
+	// ColorAuto writes colors only if every line goes to a terminal: the
+	// logger writes to standard error instead of files, standard error is
+	// a terminal and no sinks are registered. This is the default.
+	ColorAuto ColorMode = iota
+	// ColorAlways writes colors to all destinations.
+	ColorAlways
+	// ColorNever writes no colors.
+	ColorNever
+)
+
+// SetColor selects whether the colors of SetSeverityStyle are written.
+func SetColor(mode ColorMode) {
+	atomic.StoreUint32(&logging.colorMode, uint32(mode))
+	logging.updateColors()
+}
+
+// updateColors decides whether headers are colored, detecting terminals
+// for ColorAuto. It is called whenever the destinations change.
+func (l *loggingT) updateColors() {
+	var enabled bool
+	switch ColorMode(atomic.LoadUint32(&l.colorMode)) {
+	case ColorAlways:
+		enabled = true
+	case ColorAuto:
+		l.mu.Lock()
+		enabled = l.toStderr && isTerminal(stderr)
+		for _, sinks := range l.sinks {
+			enabled = enabled && len(sinks) == 0
+		}
+		l.mu.Unlock()
+	}
+	var colors uint32
+	if enabled {
+		colors = 1
+	}
+	atomic.StoreUint32(&l.colors, colors)
+}
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// styleOf returns the current header style of severity s.
+func styleOf(s Severity) severityStyle {
+	severityStylesMu.RLock()
+	defer severityStylesMu.RUnlock()
+	return severityStyles[s]
+}
+
+// severityChars returns the prefix characters of all severities, in order.
+func severityChars() string {
+	severityStylesMu.RLock()
+	defer severityStylesMu.RUnlock()
+	chars := make([]byte, numSeverity)
+	for i, style := range severityStyles {
+		chars[i] = style.char
+	}
+	return string(chars)
+}
 
 var severityName = []string{
+	debugLog:   "DEBUG",
 	infoLog:    "INFO",
 	warningLog: "WARNING",
 	errorLog:   "ERROR",
@@ -138,11 +257,33 @@ func SetV(v int) {
 	logging.verbosity.set(Level(v))
 }
 
+// SetStacktraceThreshold makes every line of severity s or higher end with
+// the stack trace of the logging goroutine. FATAL lines always dump all
+// stacks, so SetStacktraceThreshold(FatalSeverity), the default, disables
+// the traces.
+func SetStacktraceThreshold(s Severity) {
+	logging.stackThreshold.set(s)
+}
+
+// SetFileThreshold keeps lines below severity s out of the log files.
+// Unlike the verbosity it does not gate the lines: they still reach
+// stderr, sinks and the other destinations.
+//
+// The default threshold is INFO, so no DEBUG file is created. While the
+// verbosity is at least 5 (logger.Debug) the default is lowered to DEBUG.
+// SetFileThreshold(DebugSeverity) writes DEBUG lines, and a DEBUG file
+// receiving all higher lines, regardless of the verbosity.
+func SetFileThreshold(s Severity) {
+	logging.fileThreshold.set(s)
+}
+
 // SetToStderr sets the global output style
 func SetToStderr(toStderr bool) {
 	logging.mu.Lock()
 	logging.toStderr = toStderr
+	logging.updateReach()
 	logging.mu.Unlock()
+	logging.updateColors()
 }
 
 // SetAlsoToStderr sets global output option
@@ -150,9 +291,23 @@ func SetToStderr(toStderr bool) {
 func SetAlsoToStderr(to bool) {
 	logging.mu.Lock()
 	logging.alsoToStderr = to
+	logging.syslogFallback = false
+	logging.updateReach()
 	logging.mu.Unlock()
 }
 
+// setSyslogFallback writes the lines to standard error as well while
+// syslog cannot be reached, and stops doing so once it can, unless that
+// was requested with SetAlsoToStderr.
+// l.mu is held.
+func (l *loggingT) setSyslogFallback(fallback bool) {
+	if fallback && !l.alsoToStderr {
+		l.alsoToStderr, l.syslogFallback = true, true
+	} else if !fallback && l.syslogFallback {
+		l.alsoToStderr, l.syslogFallback = false, false
+	}
+}
+
 // GetTraceLocation returns the global TraceLocation flag.
 func GetTraceLocation() *TraceLocation {
 	return &logging.traceLocation
@@ -168,29 +323,48 @@ func GetVerbosity() *Level {
 	return &logging.verbosity
 }
 
+// Verbosity returns the global verbosity level.
+func Verbosity() int {
+	return int(logging.verbosity.get())
+}
+
+// SetVModule replaces the per-file verbosity settings with those of spec,
+// a comma-separated list of pattern=N as accepted by the vmodule flag.
+// Subsequent V calls use the new settings.
+func SetVModule(spec string) error {
+	return logging.vmodule.Set(spec)
+}
+
 // get returns the value of the severity.
-func (s *severity) get() severity {
-	return severity(atomic.LoadInt32((*int32)(s)))
+func (s *Severity) get() Severity {
+	return Severity(atomic.LoadInt32((*int32)(s)))
 }
 
 // set sets the value of the severity.
-func (s *severity) set(val severity) {
+func (s *Severity) set(val Severity) {
 	atomic.StoreInt32((*int32)(s), int32(val))
 }
 
-// String is part of the flag.Value interface.
-func (s *severity) String() string {
-	return strconv.FormatInt(int64(*s), 10)
+// String is part of the flag.Value interface. It returns the name of the
+// severity, as numbers are ambiguous (see Set).
+func (s *Severity) String() string {
+	v := s.get()
+	if v >= debugLog && v <= fatalLog {
+		return severityName[v]
+	}
+	return strconv.FormatInt(int64(v), 10)
 }
 
 // Get is part of the flag.Value interface.
-func (s *severity) Get() interface{} {
+func (s *Severity) Get() interface{} {
 	return *s
 }
 
-// Set is part of the flag.Value interface.
-func (s *severity) Set(value string) error {
-	var threshold severity
+// Set is part of the flag.Value interface. It accepts a severity name or
+// one of the numbers used before DEBUG was added: 0 for INFO, 1 for
+// WARNING, 2 for ERROR and 3 for FATAL.
+func (s *Severity) Set(value string) error {
+	var threshold Severity
 	// Is it a known name?
 	if v, ok := severityByName(value); ok {
 		threshold = v
@@ -199,17 +373,20 @@ func (s *severity) Set(value string) error {
 		if err != nil {
 			return err
 		}
-		threshold = severity(v)
+		if v < 0 || v > 3 {
+			return fmt.Errorf("glog: invalid severity %d", v)
+		}
+		threshold = Severity(v) + infoLog
 	}
 	logging.stderrThreshold.set(threshold)
 	return nil
 }
 
-func severityByName(s string) (severity, bool) {
+func severityByName(s string) (Severity, bool) {
 	s = strings.ToUpper(s)
 	for i, name := range severityName {
 		if name == s {
-			return severity(i), true
+			return Severity(i), true
 		}
 	}
 	return 0, false
@@ -234,15 +411,26 @@ func (s *OutputStats) Bytes() int64 {
 // Stats tracks the number of lines of output and number of bytes
 // per severity level. Values must be read with atomic.LoadInt64.
 var Stats struct {
-	Info, Warning, Error OutputStats
+	Debug, Info, Warning, Error OutputStats
 }
 
 var severityStats = [numSeverity]*OutputStats{
+	debugLog:   &Stats.Debug,
 	infoLog:    &Stats.Info,
 	warningLog: &Stats.Warning,
 	errorLog:   &Stats.Error,
 }
 
+// ResetStats sets all counters in Stats back to zero.
+func ResetStats() {
+	for _, stats := range severityStats {
+		if stats != nil {
+			atomic.StoreInt64(&stats.lines, 0)
+			atomic.StoreInt64(&stats.bytes, 0)
+		}
+	}
+}
+
 // Level is exported because it appears in the arguments to V and is
 // the type of the v flag, which can be set programmatically.
 // It's a distinct type because we want to discriminate it from logType.
@@ -297,8 +485,9 @@ type moduleSpec struct {
 // modulePat contains a filter for the -vmodule flag.
 // It holds a verbosity level and a file pattern to match.
 type modulePat struct {
-	pattern *regexp.Regexp
-	level   Level
+	pattern  *regexp.Regexp
+	level    Level
+	override bool // the pattern was written as !pattern
 }
 
 func (m *moduleSpec) String() string {
@@ -310,6 +499,9 @@ func (m *moduleSpec) String() string {
 		if i > 0 {
 			b.WriteRune(',')
 		}
+		if f.override {
+			b.WriteRune('!')
+		}
 		fmt.Fprintf(&b, "%s=%d", f.pattern, f.level)
 	}
 	return b.String()
@@ -321,34 +513,61 @@ func (m *moduleSpec) Get() interface{} {
 	return nil
 }
 
-var errVmoduleSyntax = errors.New("syntax error: expect comma-separated list of filename=N")
+// vmoduleError returns the error for the n-th clause of a vmodule spec,
+// starting at byte offset in the spec.
+func vmoduleError(n, offset int, clause, format string, args ...interface{}) error {
+	return fmt.Errorf("syntax error in vmodule clause %d %q at offset %d: %s", n, clause, offset, fmt.Sprintf(format, args...))
+}
 
 // Syntax: -vmodule=recordio=2,file=1,gfs*=3
+// The first matching clause sets the level of a file, unless a clause
+// written as !pattern=N matches it: such clauses override the others, with
+// the last matching one winning, so *=3,!p2p/discover=0 raises the level
+// everywhere except in p2p/discover.
+// Errors identify the offending clause and its position in value.
 func (m *moduleSpec) Set(value string) error {
 	var filter []modulePat
-	for _, pat := range strings.Split(value, ",") {
+	offset := 0
+	for i, pat := range strings.Split(value, ",") {
+		n, start := i+1, offset
+		offset += len(pat) + 1
 		if len(pat) == 0 {
 			// Empty strings such as from a trailing comma can be ignored.
 			continue
 		}
 		patLev := strings.Split(pat, "=")
-		if len(patLev) != 2 || len(patLev[0]) == 0 || len(patLev[1]) == 0 {
-			return errVmoduleSyntax
+		switch {
+		case len(patLev) == 1:
+			return vmoduleError(n, start, pat, "expect pattern=N")
+		case len(patLev) > 2:
+			return vmoduleError(n, start, pat, "more than one '='")
+		case len(patLev[0]) == 0:
+			return vmoduleError(n, start, pat, "empty pattern")
+		case len(patLev[1]) == 0:
+			return vmoduleError(n, start, pat, "missing level")
 		}
 		pattern := patLev[0]
+		override := strings.HasPrefix(pattern, "!")
+		if override {
+			if pattern = pattern[1:]; pattern == "" {
+				return vmoduleError(n, start, pat, "empty pattern")
+			}
+		}
 		v, err := strconv.Atoi(patLev[1])
 		if err != nil {
-			return errors.New("syntax error: expect comma-separated list of filename=N")
+			return vmoduleError(n, start, pat, "level %q is not a number", patLev[1])
 		}
 		if v < 0 {
-			return errors.New("negative value for vmodule level")
+			return vmoduleError(n, start, pat, "negative level %d", v)
 		}
-		if v == 0 {
+		if v == 0 && !override {
 			continue // Ignore. It's harmless but no point in paying the overhead.
 		}
-		// TODO: check syntax of filter?
-		re, _ := compileModulePattern(pattern)
-		filter = append(filter, modulePat{re, Level(v)})
+		re, err := compileModulePattern(pattern)
+		if err != nil {
+			return vmoduleError(n, start, pat, "bad pattern %q: %v", pattern, err)
+		}
+		filter = append(filter, modulePat{re, Level(v), override})
 	}
 	logging.mu.Lock()
 	defer logging.mu.Unlock()
@@ -421,6 +640,7 @@ func (t *TraceLocation) Set(value string) error {
 		logging.mu.Lock()
 		t.line = 0
 		t.file = ""
+		t.updateSet()
 		logging.mu.Unlock()
 		return nil
 	}
@@ -444,9 +664,24 @@ func (t *TraceLocation) Set(value string) error {
 	defer logging.mu.Unlock()
 	t.line = v
 	t.file = file
+	t.updateSet()
 	return nil
 }
 
+// updateSet publishes whether the -log_backtrace_at flag is set, so that
+// output can skip locking when it is not.
+// logging.mu is held.
+func (t *TraceLocation) updateSet() {
+	if t != &logging.traceLocation {
+		return
+	}
+	var set uint32
+	if t.isSet() {
+		set = 1
+	}
+	atomic.StoreUint32(&logging.traceSet, set)
+}
+
 // flushSyncWriter is the interface satisfied by logging destinations.
 type flushSyncWriter interface {
 	Flush() error
@@ -464,8 +699,13 @@ func init() {
 
 	// Default stderrThreshold is ERROR.
 	logging.stderrThreshold = errorLog
+	// FATAL lines dump all stacks anyway, so this disables stack traces.
+	logging.stackThreshold = fatalLog
+	// DEBUG lines reach the files only once debug output is enabled.
+	logging.fileThreshold = infoLog
+	logging.headerParts = uint32(HeaderAll)
+	logging.updateColors()
 	logging.setVState(3, nil, false)
-	go logging.flushDaemon()
 }
 
 // Flush flushes all pending log I/O.
@@ -482,7 +722,13 @@ type loggingT struct {
 	alsoToStderr bool // The -alsologtostderr flag.
 
 	// Level flag. Handled atomically.
-	stderrThreshold severity // The -stderrthreshold flag.
+	stderrThreshold Severity // The -stderrthreshold flag.
+	// stackThreshold is the lowest severity whose lines get a stack trace.
+	// Handled atomically.
+	stackThreshold Severity
+	// fileThreshold is the lowest severity written to the log files,
+	// see fileMin. Handled atomically.
+	fileThreshold Severity
 
 	// freeList is a list of byte buffers, maintained under freeListMu.
 	freeList *buffer
@@ -496,6 +742,38 @@ type loggingT struct {
 	mu sync.Mutex
 	// file holds writer for each of the log types.
 	file [numSeverity]flushSyncWriter
+	// crons caches the parsed rotation schedules by expression, nil for
+	// invalid ones.
+	crons map[string]*cronSchedule
+	// rotation holds the rotation settings of each log type.
+	rotation [numSeverity]RotationConfig
+	// noCascade stops lines from being copied to the files of the lower
+	// log types.
+	noCascade bool
+	// combined, if combinedFile is set, receives the lines of all log types.
+	combined     flushSyncWriter
+	combinedFile bool
+	// pruneErr is the error of the last deletion of old log files.
+	pruneErr error
+	// flushQuit and flushDone stop and await the flush daemon. They are
+	// nil while it is not running.
+	flushQuit, flushDone chan struct{}
+	// collapseDups is non-zero if SetCollapseDuplicates is in effect. It is
+	// accessed atomically.
+	collapseDups uint32
+	// repeats holds the run of identical lines of each log type. It is
+	// guarded by repeatsMu, not mu, which is held while the lines of a run
+	// and its count are written so that they stay in order.
+	repeatsMu sync.Mutex
+	repeats   [numSeverity]repeatState
+	// holdNotify is set while repeatsMu is held to write lines. OnRotate
+	// callbacks are held back meanwhile, as one that logs would need
+	// repeatsMu. It is accessed atomically.
+	holdNotify uint32
+	// rotations lists the files rotated while mu is held, for OnRotate.
+	rotations []rotation
+	// sinks holds the extra writers of each log type, in registration order.
+	sinks [numSeverity][]*sink
 	// pcs is used in V to avoid an allocation when computing the caller's PC.
 	pcs [1]uintptr
 	// vmap is a cache of the V Level for each V() call site, identified by PC.
@@ -507,17 +785,70 @@ type loggingT struct {
 	filterLength int32
 	// traceLocation is the state of the -log_backtrace_at flag.
 	traceLocation TraceLocation
+	// traceSet is 1 if traceLocation is set. It may be read safely using
+	// atomic.LoadUint32, but is only modified under mu.
+	traceSet uint32
 	// These flags are modified only under lock, although verbosity may be fetched
 	// safely using atomic.LoadInt32.
 	vmodule   moduleSpec // The state of the -vmodule flag.
 	verbosity Level      // V logging level, the value of the -v flag/
+
+	// headerParts is the HeaderParts mask of segments written in headers.
+	// It is accessed atomically.
+	headerParts uint32
+	// fieldSep holds the separator set by SetFieldSeparator, or nothing
+	// for the default single space.
+	fieldSep atomic.Value
+	// colorMode is the ColorMode set by SetColor and colors is non-zero if
+	// headers are colored as a result. Both are accessed atomically.
+	colorMode, colors uint32
+	// timeFormat holds the layout string set by SetTimeFormat, and utc is
+	// non-zero if header times are in UTC. Both are accessed atomically.
+	timeFormat atomic.Value
+	utc        uint32
+	timeMode   uint32
+	// format is the Format of log lines. It is accessed atomically.
+	format uint32
+	// hidePID is non-zero if JSON lines omit the pid. It is accessed
+	// atomically.
+	hidePID uint32
+
+	// otlp, if non-nil, exports every line to an OpenTelemetry collector.
+	otlp *otlpExporter
+	// syslog, if non-nil, sends every line to the syslog daemon.
+	syslog syslogger
+	// reach has bit s set if lines of severity s reach standard error,
+	// syslog, OTLP or a sink regardless of the thresholds. It is
+	// recomputed under mu by updateReach and read atomically by enabled,
+	// which must not take mu.
+	reach uint32
+	// syslogFallback is set while alsoToStderr is on only because SetSyslog
+	// failed to reach the daemon.
+	syslogFallback bool
+	// clock holds the clockValue installed by SetClock.
+	clock atomic.Value
+	// transform holds the TransformFunc installed by SetTransform. It is
+	// read without holding mu, so that transforms may log themselves.
+	transform atomic.Value
+	// ring holds the *ringBuffer installed by EnableRingBuffer. It is read
+	// without holding mu, so that RecentLines does not contend with logging.
+	ring atomic.Value
+	// async holds the *asyncWriter installed by SetAsync. It is read
+	// without holding mu; asyncMu serializes its replacement.
+	async   atomic.Value
+	asyncMu sync.Mutex
 }
 
 // buffer holds a byte Buffer for reuse. The zero value is ready for use.
 type buffer struct {
 	bytes.Buffer
-	tmp  [64]byte // temporary byte array for creating headers.
-	next *buffer
+	tmp    [64]byte  // temporary byte array for creating headers.
+	hlen   int       // length of the header at the start of the buffer.
+	json   bool      // the line is to be formatted as JSON; the header is empty.
+	fields []field   // structured fields of the line.
+	time   time.Time // time stamp written in the header.
+	queued bool      // the line was handed to the asynchronous writer.
+	next   *buffer
 }
 
 var logging loggingT
@@ -573,6 +904,32 @@ func (l *loggingT) putBuffer(b *buffer) {
 
 var timeNow = time.Now // Stubbed out for testing.
 
+// Clock is a source of the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// clockValue wraps the Clock stored in loggingT.clock, as atomic.Value
+// requires a consistent concrete type.
+type clockValue struct {
+	Clock
+}
+
+// SetClock makes the logger read the time from c for headers, log file
+// names and rotation, e.g. to replay logs deterministically. A nil c
+// restores the system clock.
+func SetClock(c Clock) {
+	logging.clock.Store(clockValue{c})
+}
+
+// now returns the current time according to the logger's clock.
+func (l *loggingT) now() time.Time {
+	if c, _ := l.clock.Load().(clockValue); c.Clock != nil {
+		return c.Now()
+	}
+	return timeNow()
+}
+
 /*
 header formats a log header as defined by the C++ implementation.
 It returns a buffer containing the formatted header and the user's file and line number.
@@ -590,27 +947,35 @@ where the fields are defined as follows:
 	line             The line number
 	msg              The user-supplied message
 */
-func (l *loggingT) header(s severity, depth int) (*buffer, string, int) {
+func (l *loggingT) header(s Severity, depth int) (*buffer, string, int) {
 	_, file, line, ok := runtime.Caller(3 + depth)
 	if !ok {
 		file = "???"
 		line = 1
 	} else {
-		file = trimToImportPath(file)
-		for _, p := range trimPrefixes {
-			if strings.HasPrefix(file, p) {
-				file = file[len(p):]
-				break
-			}
-		}
-		file = file[1:] // drop '/'
+		file = headerFile(file)
 	}
 	return l.formatHeader(s, file, line), file, line
 }
 
+// headerFile shortens the path of a source file for the log header.
+func headerFile(file string) string {
+	file = trimToImportPath(file)
+	for _, p := range trimPrefixes {
+		if strings.HasPrefix(file, p) {
+			file = file[len(p):]
+			break
+		}
+	}
+	return file[1:] // drop '/'
+}
+
 // formatHeader formats a log header using the provided file name and line number.
-func (l *loggingT) formatHeader(s severity, file string, line int) *buffer {
-	now := timeNow()
+func (l *loggingT) formatHeader(s Severity, file string, line int) *buffer {
+	now := l.now()
+	if atomic.LoadUint32(&l.utc) != 0 {
+		now = now.UTC()
+	}
 	if line < 0 {
 		line = 0 // not a real line number, but acceptable to someDigits
 	}
@@ -618,34 +983,143 @@ func (l *loggingT) formatHeader(s severity, file string, line int) *buffer {
 		s = infoLog // for safety.
 	}
 	buf := l.getBuffer()
+	buf.time = now
+	buf.fields = nil
+	buf.queued = false
+	if buf.json = Format(atomic.LoadUint32(&l.format)) == FormatJSON; buf.json {
+		buf.hlen = 0 // the JSON object is built by output
+		return buf
+	}
 
 	// Avoid Fprintf, for speed. The format is so simple that we can do it quickly by hand.
 	// It's worth about 3X. Fprintf is hard.
-	_, month, day := now.Date()
-	hour, minute, second := now.Clock()
+	parts := HeaderParts(atomic.LoadUint32(&l.headerParts))
+	sep, _ := l.fieldSep.Load().(string)
+	if sep == "" {
+		sep = " "
+	}
 	// Lmmdd hh:mm:ss.uuuuuu threadid file:line]
-	buf.tmp[0] = severityChar[s]
-	buf.twoDigits(1, int(month))
-	buf.twoDigits(3, day)
-	buf.tmp[5] = ' '
-	buf.twoDigits(6, hour)
-	buf.tmp[8] = ':'
-	buf.twoDigits(9, minute)
-	buf.tmp[11] = ':'
-	buf.twoDigits(12, second)
-	buf.tmp[14] = '.'
-	buf.nDigits(6, 15, now.Nanosecond()/1000, '0')
-	buf.tmp[21] = ' '
-	buf.Write(buf.tmp[:22])
-	buf.WriteString(file)
-	buf.tmp[0] = ':'
-	n := buf.someDigits(1, line)
-	buf.tmp[n+1] = ']'
-	buf.tmp[n+2] = ' '
-	buf.Write(buf.tmp[:n+3])
+	if parts&HeaderSeverity != 0 {
+		if style := styleOf(s); style.color != "" && atomic.LoadUint32(&l.colors) != 0 {
+			buf.WriteString(style.color)
+			buf.WriteByte(style.char)
+			buf.WriteString(severityColorReset)
+		} else {
+			buf.WriteByte(style.char)
+		}
+	}
+	if mode := TimeMode(atomic.LoadUint32(&l.timeMode)); parts&HeaderTime != 0 && mode != TimeHuman {
+		ts := now.UnixNano()
+		if mode == TimeEpochMillis {
+			ts /= int64(time.Millisecond)
+		}
+		buf.Write(strconv.AppendInt(buf.tmp[:0], ts, 10))
+		buf.WriteString(sep)
+	} else if layout, _ := l.timeFormat.Load().(string); parts&HeaderTime != 0 && layout != "" {
+		buf.WriteString(now.Format(layout))
+		buf.WriteString(sep)
+	} else if parts&HeaderTime != 0 {
+		_, month, day := now.Date()
+		hour, minute, second := now.Clock()
+		buf.twoDigits(1, int(month))
+		buf.twoDigits(3, day)
+		buf.tmp[5] = ' '
+		buf.twoDigits(6, hour)
+		buf.tmp[8] = ':'
+		buf.twoDigits(9, minute)
+		buf.tmp[11] = ':'
+		buf.twoDigits(12, second)
+		buf.tmp[14] = '.'
+		buf.nDigits(6, 15, now.Nanosecond()/1000, '0')
+		buf.tmp[21] = ' '
+		if sep == " " {
+			buf.Write(buf.tmp[1:22])
+		} else {
+			buf.Write(buf.tmp[1:5])
+			buf.WriteString(sep)
+			buf.Write(buf.tmp[6:21])
+			buf.WriteString(sep)
+		}
+	} else if parts&HeaderSeverity != 0 {
+		buf.WriteString(sep)
+	}
+	if parts&HeaderLocation != 0 {
+		buf.WriteString(file)
+		buf.tmp[0] = ':'
+		n := buf.someDigits(1, line)
+		buf.tmp[n+1] = ']'
+		buf.tmp[n+2] = ' '
+		if sep == " " {
+			buf.Write(buf.tmp[:n+3])
+		} else {
+			buf.Write(buf.tmp[:n+2])
+			buf.WriteString(sep)
+		}
+	}
+	buf.hlen = buf.Len()
 	return buf
 }
 
+// HeaderParts is a bit mask selecting the segments written in log headers.
+type HeaderParts uint32
+
+const (
+	HeaderSeverity HeaderParts = 1 << iota // the severity character, e.g. 'I'
+	HeaderTime                             // the mmdd hh:mm:ss.uuuuuu time stamp
+	HeaderLocation                         // the file:line] source location
+
+	HeaderAll = HeaderSeverity | HeaderTime | HeaderLocation
+)
+
+// SetHeaderParts selects the segments written in log headers. The default
+// is HeaderAll; omitting HeaderLocation keeps source paths out of the logs.
+func SetHeaderParts(parts HeaderParts) {
+	atomic.StoreUint32(&logging.headerParts, uint32(parts&HeaderAll))
+}
+
+// SetFieldSeparator sets the separator written between the date and the
+// time of headers, after the time and between the header and the message,
+// e.g. "\t" for lines that are easy to split with awk. An empty separator
+// restores the default single space. ParseLine only parses the default.
+func SetFieldSeparator(sep string) {
+	logging.fieldSep.Store(sep)
+}
+
+// SetTimeFormat makes headers show the time in the given layout, as used
+// by time.Format, instead of mmdd hh:mm:ss.uuuuuu. An empty layout
+// restores the default. ParseLine only parses the default format.
+func SetTimeFormat(layout string) {
+	logging.timeFormat.Store(layout)
+}
+
+// TimeMode selects how headers show the time.
+type TimeMode uint32
+
+const (
+	// TimeHuman shows the time as mmdd hh:mm:ss.uuuuuu or in the layout set
+	// by SetTimeFormat. It is the default.
+	TimeHuman TimeMode = iota
+	// TimeEpochMillis shows the milliseconds since the Unix epoch.
+	TimeEpochMillis
+	// TimeEpochNanos shows the nanoseconds since the Unix epoch.
+	TimeEpochNanos
+)
+
+// SetTimeMode selects how headers show the time. The epoch modes write a
+// number that sorts easily and ignore SetTimeFormat and UseUTC.
+func SetTimeMode(mode TimeMode) {
+	atomic.StoreUint32(&logging.timeMode, uint32(mode))
+}
+
+// UseUTC makes headers show times in UTC rather than local time.
+func UseUTC(utc bool) {
+	var v uint32
+	if utc {
+		v = 1
+	}
+	atomic.StoreUint32(&logging.utc, v)
+}
+
 // Some custom tiny helper functions to print the log header efficiently.
 
 const digits = "0123456789"
@@ -687,17 +1161,92 @@ func (buf *buffer) someDigits(i, d int) int {
 	return copy(buf.tmp[i:], buf.tmp[j:])
 }
 
-func (l *loggingT) println(s severity, args ...interface{}) {
+// Record is a log line parsed back into its parts by ParseLine.
+type Record struct {
+	Severity Severity
+	Time     time.Time
+	File     string
+	Line     int
+	Message  string
+}
+
+var errParseLine = errors.New("glog: line does not start with a log header")
+
+// ParseLine parses a line written with the default header format back into
+// a Record. It is the inverse of formatHeader and tolerates the color
+// sequences set with SetSeverityStyle. Headers do not contain the year, so
+// the current one is assumed, in the local time zone.
+func ParseLine(line string) (Record, error) {
+	var r Record
+	// Severity character, optionally wrapped in a color sequence.
+	if strings.HasPrefix(line, "\x1b[") {
+		end := strings.IndexByte(line, 'm')
+		if end < 0 || end+2 > len(line) || !strings.HasPrefix(line[end+2:], severityColorReset) {
+			return r, errParseLine
+		}
+		line = line[end+1:end+2] + line[end+2+len(severityColorReset):]
+	}
+	if len(line) < 22 || line[5] != ' ' || line[8] != ':' || line[11] != ':' || line[14] != '.' || line[21] != ' ' {
+		return r, errParseLine
+	}
+	sev, ok := severityByChar(line[0])
+	if !ok {
+		return r, fmt.Errorf("glog: unknown severity character %q", line[0])
+	}
+	// Time stamp: mmdd hh:mm:ss.uuuuuu
+	var fields [6]int
+	for i, f := range []struct{ start, end int }{{1, 3}, {3, 5}, {6, 8}, {9, 11}, {12, 14}, {15, 21}} {
+		n, err := strconv.Atoi(line[f.start:f.end])
+		if err != nil {
+			return r, errParseLine
+		}
+		fields[i] = n
+	}
+	// Location: file:line]
+	rest := line[22:]
+	end := strings.Index(rest, "] ")
+	if end < 0 {
+		return r, errParseLine
+	}
+	colon := strings.LastIndex(rest[:end], ":")
+	if colon < 0 {
+		return r, errParseLine
+	}
+	lineno, err := strconv.Atoi(rest[colon+1 : end])
+	if err != nil {
+		return r, errParseLine
+	}
+	r.Severity = sev
+	r.Time = time.Date(logging.now().Year(), time.Month(fields[0]), fields[1], fields[2], fields[3], fields[4], fields[5]*1000, time.Local)
+	r.File = rest[:colon]
+	r.Line = lineno
+	r.Message = strings.TrimSuffix(rest[end+2:], "\n")
+	return r, nil
+}
+
+// severityByChar returns the severity whose header character is c.
+func severityByChar(c byte) (Severity, bool) {
+	severityStylesMu.RLock()
+	defer severityStylesMu.RUnlock()
+	for i, style := range severityStyles {
+		if style.char == c {
+			return Severity(i), true
+		}
+	}
+	return 0, false
+}
+
+func (l *loggingT) println(s Severity, args ...interface{}) {
 	buf, file, line := l.header(s, 0)
 	fmt.Fprintln(buf, args...)
 	l.output(s, buf, file, line, false)
 }
 
-func (l *loggingT) print(s severity, args ...interface{}) {
+func (l *loggingT) print(s Severity, args ...interface{}) {
 	l.printDepth(s, 1, args...)
 }
 
-func (l *loggingT) printDepth(s severity, depth int, args ...interface{}) {
+func (l *loggingT) printDepth(s Severity, depth int, args ...interface{}) {
 	buf, file, line := l.header(s, depth)
 	fmt.Fprint(buf, args...)
 	if buf.Bytes()[buf.Len()-1] != '\n' {
@@ -706,7 +1255,7 @@ func (l *loggingT) printDepth(s severity, depth int, args ...interface{}) {
 	l.output(s, buf, file, line, false)
 }
 
-func (l *loggingT) printfmt(s severity, format string, args ...interface{}) {
+func (l *loggingT) printfmt(s Severity, format string, args ...interface{}) {
 	buf, file, line := l.header(s, 0)
 	fmt.Fprintf(buf, format, args...)
 	if buf.Bytes()[buf.Len()-1] != '\n' {
@@ -718,7 +1267,7 @@ func (l *loggingT) printfmt(s severity, format string, args ...interface{}) {
 // printWithFileLine behaves like print but uses the provided file and line number.  If
 // alsoLogToStderr is true, the log message always appears on standard error; it
 // will also appear in the log file unless --logtostderr is set.
-func (l *loggingT) printWithFileLine(s severity, file string, line int, alsoToStderr bool, args ...interface{}) {
+func (l *loggingT) printWithFileLine(s Severity, file string, line int, alsoToStderr bool, args ...interface{}) {
 	buf := l.formatHeader(s, file, line)
 	fmt.Fprint(buf, args...)
 	if buf.Bytes()[buf.Len()-1] != '\n' {
@@ -727,41 +1276,142 @@ func (l *loggingT) printWithFileLine(s severity, file string, line int, alsoToSt
 	l.output(s, buf, file, line, alsoToStderr)
 }
 
+// TransformFunc rewrites the message of a log line of the given severity.
+// The message is passed without the header and trailing newline.
+type TransformFunc func(s Severity, msg string) string
+
+// SetTransform installs fn to rewrite every message before it is written,
+// e.g. to add a correlation ID or to normalize whitespace. The header is
+// not passed to fn and is kept as is. A nil fn removes the transform.
+func SetTransform(fn TransformFunc) {
+	logging.transform.Store(fn)
+}
+
 // output writes the data to the log files and releases the buffer.
-func (l *loggingT) output(s severity, buf *buffer, file string, line int, alsoToStderr bool) {
-	l.mu.Lock()
-	if l.traceLocation.isSet() {
-		if l.traceLocation.match(file, line) {
-			buf.Write(stacks(false))
+func (l *loggingT) output(s Severity, buf *buffer, file string, line int, alsoToStderr bool) {
+	if fn, _ := l.transform.Load().(TransformFunc); fn != nil {
+		msg := strings.TrimSuffix(string(buf.Bytes()[buf.hlen:]), "\n")
+		buf.Truncate(buf.hlen)
+		buf.WriteString(fn(s, msg))
+		if buf.Len() == 0 || buf.Bytes()[buf.Len()-1] != '\n' {
+			buf.WriteByte('\n')
 		}
 	}
+	if s != fatalLog && atomic.LoadUint32(&l.collapseDups) != 0 {
+		l.collapse(s, buf, file, line, alsoToStderr)
+		return
+	}
+	l.emit(s, buf, file, line, alsoToStderr)
+}
+
+// emit writes a formatted line, queueing it if SetAsync is in effect.
+func (l *loggingT) emit(s Severity, buf *buffer, file string, line int, alsoToStderr bool) {
+	if a, _ := l.async.Load().(*asyncWriter); a != nil {
+		if s == fatalLog {
+			a.sync()
+		} else {
+			// The stack trace must be taken here, on the logging goroutine.
+			var trace bool
+			if atomic.LoadUint32(&l.traceSet) != 0 {
+				l.mu.Lock()
+				trace = l.traceLocation.isSet() && l.traceLocation.match(file, line)
+				l.mu.Unlock()
+			}
+			if trace || s >= l.stackThreshold.get() {
+				buf.Write(stacks(false))
+			}
+			buf.queued = true
+			if a.enqueue(s, buf, file, line, alsoToStderr) {
+				return
+			}
+		}
+	}
+	l.writeLine(s, buf, file, line, alsoToStderr)
+}
+
+// writeLine writes a formatted line to the log files and other destinations
+// and releases the buffer.
+func (l *loggingT) writeLine(s Severity, buf *buffer, file string, line int, alsoToStderr bool) {
+	l.mu.Lock()
+	if buf.queued {
+		// The stack trace, if any, has been taken by output.
+	} else if l.traceLocation.isSet() && l.traceLocation.match(file, line) {
+		buf.Write(stacks(false))
+	} else if s >= l.stackThreshold.get() && s != fatalLog {
+		buf.Write(stacks(false))
+	}
 	data := buf.Bytes()
+	if buf.json {
+		jbuf := l.getBuffer()
+		defer l.putBuffer(jbuf)
+		l.formatJSON(jbuf, s, buf.time, file, line, data, buf.fields)
+		data = jbuf.Bytes()
+	}
 	if l.toStderr {
-		os.Stderr.Write(data)
+		l.writeStderr(data)
 	} else {
 		if alsoToStderr || l.alsoToStderr || s >= l.stderrThreshold.get() {
-			os.Stderr.Write(data)
+			l.writeStderr(data)
 		}
-		if l.file[s] == nil {
-			if err := l.createFiles(s); err != nil {
-				os.Stderr.Write(data) // Make sure the message appears somewhere.
-				l.exit(err)
+		if min := l.fileMin(); s >= min {
+			floor := fileFloor(min)
+			if l.file[s] == nil || l.file[floor] == nil {
+				if err := l.createFiles(s, floor); err != nil {
+					l.writeStderr(data) // Make sure the message appears somewhere.
+					l.exit(err)
+				}
+			}
+			if l.noCascade {
+				l.file[s].Write(data)
+			} else {
+				switch s {
+				case fatalLog:
+					l.file[fatalLog].Write(data)
+					fallthrough
+				case errorLog:
+					l.file[errorLog].Write(data)
+					fallthrough
+				case warningLog:
+					l.file[warningLog].Write(data)
+					fallthrough
+				case infoLog:
+					l.file[infoLog].Write(data)
+					fallthrough
+				case debugLog:
+					if floor == debugLog {
+						l.file[debugLog].Write(data)
+					}
+				}
+			}
+			if l.combinedFile {
+				if l.combined == nil {
+					if err := l.createCombined(); err != nil {
+						l.writeStderr(data) // Make sure the message appears somewhere.
+						l.exit(err)
+					}
+				}
+				if l.combined != nil {
+					l.combined.Write(data)
+				}
 			}
 		}
-		switch s {
-		case fatalLog:
-			l.file[fatalLog].Write(data)
-			fallthrough
-		case errorLog:
-			l.file[errorLog].Write(data)
-			fallthrough
-		case warningLog:
-			l.file[warningLog].Write(data)
-			fallthrough
-		case infoLog:
-			l.file[infoLog].Write(data)
+		if interval := FlushInterval; interval <= 0 {
+			l.flushBuffers()
+		} else if l.flushQuit == nil {
+			l.flushQuit, l.flushDone = make(chan struct{}), make(chan struct{})
+			go l.flushDaemon(interval, l.flushQuit, l.flushDone)
 		}
 	}
+	l.writeSinks(s, data)
+	if l.syslog != nil {
+		l.writeSyslog(s, buf, data, file, line)
+	}
+	if l.otlp != nil {
+		l.otlp.enqueue(s, buf.time, file, line, buf.Bytes()[buf.hlen:], buf.fields)
+	}
+	if r, _ := l.ring.Load().(*ringBuffer); r != nil {
+		r.add(s, string(data))
+	}
 	if s == fatalLog {
 		// If we got here via Exit rather than Fatal, print no stacks.
 		if atomic.LoadUint32(&fatalNoStacks) > 0 {
@@ -774,12 +1424,12 @@ func (l *loggingT) output(s severity, buf *buffer, file string, line int, alsoTo
 		// If -logtostderr has been specified, the loop below will do that anyway
 		// as the first stack in the full dump.
 		if !l.toStderr {
-			os.Stderr.Write(stacks(false))
+			l.writeStderr(stacks(false))
 		}
 		// Write the stack trace for all goroutines to the files.
 		trace := stacks(true)
 		logExitFunc = func(error) {} // If we get a write error, we'll still exit below.
-		for log := fatalLog; log >= infoLog; log-- {
+		for log := fatalLog; log >= debugLog; log-- {
 			if f := l.file[log]; f != nil { // Can be nil if -logtostderr is set.
 				f.Write(trace)
 			}
@@ -788,14 +1438,29 @@ func (l *loggingT) output(s severity, buf *buffer, file string, line int, alsoTo
 		timeoutFlush(10 * time.Second)
 		os.Exit(255) // C++ uses -1, which is silly because it's anded with 255 anyway.
 	}
+	queued := buf.queued
 	l.putBuffer(buf)
-	l.mu.Unlock()
+	if queued {
+		l.unlockAndNotifyAsync()
+	} else {
+		l.unlockAndNotify()
+	}
 	if stats := severityStats[s]; stats != nil {
 		atomic.AddInt64(&stats.lines, 1)
 		atomic.AddInt64(&stats.bytes, int64(len(data)))
 	}
 }
 
+// stderr receives the lines written to standard error. Tests replace it.
+var stderr io.Writer = os.Stderr
+
+// writeStderr writes data to standard error in a single Write call, so
+// that lines logged concurrently never interleave.
+// l.mu is held.
+func (l *loggingT) writeStderr(data []byte) {
+	stderr.Write(data) // ignore error
+}
+
 // timeoutFlush calls Flush and returns when it completes or after timeout
 // elapses, whichever happens first.  This is needed because the hooks invoked
 // by Flush may deadlock when glog.Fatal is called from a hook that holds
@@ -860,8 +1525,12 @@ type syncBuffer struct {
 	logger *loggingT
 	*bufio.Writer
 	file   *os.File
-	sev    severity
+	sev    Severity
+	tag    string // The file name tag, e.g. "INFO" or combinedTag
 	nbytes uint64 // The number of bytes written to this file
+	// rotateAt is the time the file is due to be rotated under
+	// RotationCron, or zero.
+	rotateAt time.Time
 }
 
 func (sb *syncBuffer) Sync() error {
@@ -869,31 +1538,62 @@ func (sb *syncBuffer) Sync() error {
 }
 
 func (sb *syncBuffer) Write(p []byte) (n int, err error) {
-	if sb.nbytes+uint64(len(p)) >= MaxSize {
-		if err := sb.rotateFile(time.Now()); err != nil {
+	if sb.shouldRotate(len(p)) {
+		if err := sb.rotateFile(sb.logger.now()); err != nil {
 			sb.logger.exit(err)
 		}
 	}
 	n, err = sb.Writer.Write(p)
-	sb.nbytes += uint64(n)
+	sb.addBytes(n)
 	if err != nil {
 		sb.logger.exit(err)
 	}
 	return
 }
 
+// shouldRotate reports whether writing n more bytes requires a new file.
+func (sb *syncBuffer) shouldRotate(n int) bool {
+	if !sb.rotateAt.IsZero() && !sb.logger.now().Before(sb.rotateAt) {
+		return true
+	}
+	maxSize := MaxSize
+	if sb.tag != combinedTag {
+		if size := sb.logger.rotation[sb.sev].MaxSize; size > 0 {
+			maxSize = size
+		}
+	}
+	return sb.nbytes+uint64(n) >= maxSize
+}
+
+// cronExpr returns the cron expression at which the file is rotated.
+func (sb *syncBuffer) cronExpr() string {
+	if sb.tag != combinedTag {
+		if expr := sb.logger.rotation[sb.sev].Cron; expr != "" {
+			return expr
+		}
+	}
+	return RotationCron
+}
+
 // rotateFile closes the syncBuffer's file and starts a new one.
 func (sb *syncBuffer) rotateFile(now time.Time) error {
+	var oldPath string
 	if sb.file != nil {
 		sb.Flush()
 		sb.file.Close()
+		oldPath = sb.file.Name()
 	}
-	var err error
-	sb.file, _, err = create(severityName[sb.sev], now)
+	var (
+		fname string
+		err   error
+	)
+	sb.file, fname, err = create(sb.tag, now)
 	sb.nbytes = 0
 	if err != nil {
 		return err
 	}
+	sb.rotateAt = sb.logger.nextRotation(sb.cronExpr(), now)
+	sb.logger.prune(sb.tag, fname)
 
 	sb.Writer = bufio.NewWriterSize(sb.file, bufferSize)
 
@@ -902,27 +1602,220 @@ func (sb *syncBuffer) rotateFile(now time.Time) error {
 	fmt.Fprintf(&buf, "Log file created at: %s\n", now.Format("2006/01/02 15:04:05"))
 	fmt.Fprintf(&buf, "Running on machine: %s\n", host)
 	fmt.Fprintf(&buf, "Binary: Built with %s %s for %s/%s\n", runtime.Compiler, runtime.Version(), runtime.GOOS, runtime.GOARCH)
-	fmt.Fprintf(&buf, "Log line format: [IWEF]mmdd hh:mm:ss.uuuuuu threadid file:line] msg\n")
+	fmt.Fprintf(&buf, "Log line format: [%s]mmdd hh:mm:ss.uuuuuu threadid file:line] msg\n", severityChars())
 	n, err := sb.file.Write(buf.Bytes())
-	sb.nbytes += uint64(n)
+	sb.addBytes(n)
+	if oldPath != "" {
+		sb.logger.rotations = append(sb.logger.rotations, rotation{oldPath, fname, sb.sev})
+	}
 	return err
 }
 
+// rotation describes a rotated log file for the OnRotate callbacks.
+type rotation struct {
+	oldPath, newPath string
+	sev              Severity
+}
+
+// onRotate holds the callbacks registered with OnRotate.
+var onRotate struct {
+	sync.Mutex
+	fns []func(oldPath, newPath string, s Severity)
+}
+
+// OnRotate registers fn to be called whenever a log file is replaced by a
+// new one, e.g. to start uploading the old file. fn receives the paths of
+// both files and the severity of the file; the combined file is reported
+// as INFO. It is not called when the first file of a severity is created.
+// Callbacks are called in registration order after the logging lock has
+// been released, so they may log. For lines written by SetAsync they are
+// called on a separate goroutine.
+func OnRotate(fn func(oldPath, newPath string, s Severity)) {
+	onRotate.Lock()
+	onRotate.fns = append(onRotate.fns, fn)
+	onRotate.Unlock()
+}
+
+// unlockAndNotify releases l.mu and then calls the OnRotate callbacks for
+// the rotations made while it was held. While holdNotify is set they are
+// left for unlockRepeats instead.
+// l.mu is held.
+func (l *loggingT) unlockAndNotify() {
+	if atomic.LoadUint32(&l.holdNotify) != 0 {
+		l.mu.Unlock()
+		return
+	}
+	rotations := l.rotations
+	l.rotations = nil
+	l.mu.Unlock()
+	notifyRotations(rotations)
+}
+
+// unlockAndNotifyAsync is like unlockAndNotify for lines written by the
+// asynchronous writer. The callbacks run on their own goroutine, as one
+// that flushes or logs would otherwise wait for the writer itself.
+// l.mu is held.
+func (l *loggingT) unlockAndNotifyAsync() {
+	rotations := l.rotations
+	l.rotations = nil
+	l.mu.Unlock()
+	if len(rotations) > 0 {
+		go notifyRotations(rotations)
+	}
+}
+
+// notifyRotations calls the OnRotate callbacks for rotations.
+func notifyRotations(rotations []rotation) {
+	if len(rotations) == 0 {
+		return
+	}
+	onRotate.Lock()
+	fns := onRotate.fns
+	onRotate.Unlock()
+	for _, r := range rotations {
+		for _, fn := range fns {
+			fn(r.oldPath, r.newPath, r.sev)
+		}
+	}
+}
+
+// addBytes accounts for n bytes written to the file.
+func (sb *syncBuffer) addBytes(n int) {
+	sb.nbytes += uint64(n)
+	if sb.tag != combinedTag {
+		atomic.AddUint64(&bytesWritten[sb.sev], uint64(n))
+	}
+}
+
+// bytesWritten counts the bytes written to the files of each severity,
+// across rotations. It is a package variable, rather than a field of
+// loggingT, to guarantee the alignment needed for atomic access.
+var bytesWritten [numSeverity]uint64
+
+// BytesWritten returns the number of bytes written to the log files of
+// each severity since the program started, including rotated files.
+func BytesWritten() [numSeverity]uint64 {
+	var written [numSeverity]uint64
+	for i := range written {
+		written[i] = atomic.LoadUint64(&bytesWritten[i])
+	}
+	return written
+}
+
+// RotationCron, if non-empty, is a cron expression, e.g. "0 0,12 * * *"
+// for midnight and noon, at which the log files are rotated in addition
+// to when they reach their maximum size. The fields are minute, hour,
+// day of month, month and day of week, in local time. The next rotation
+// time is computed when a file is created. An invalid expression is
+// reported on standard error and ignored. RotationConfig.Cron overrides
+// it per severity.
+var RotationCron string
+
+// nextRotation returns the time after now at which a file is rotated
+// under the cron expression expr, or zero.
+// l.mu is held.
+func (l *loggingT) nextRotation(expr string, now time.Time) time.Time {
+	if expr == "" {
+		return time.Time{}
+	}
+	cron, ok := l.crons[expr]
+	if !ok {
+		var err error
+		if cron, err = parseCron(expr); err != nil {
+			fmt.Fprintf(os.Stderr, "log: ignoring rotation cron: %v\n", err)
+		}
+		if l.crons == nil {
+			l.crons = make(map[string]*cronSchedule)
+		}
+		l.crons[expr] = cron
+	}
+	if cron == nil {
+		return time.Time{}
+	}
+	t, _ := cron.next(now) // zero if it never fires
+	return t
+}
+
+// RotationConfig holds the rotation settings of a severity's log file.
+type RotationConfig struct {
+	// MaxSize is the size in bytes at which the file is rotated.
+	// Zero means the package-level MaxSize.
+	MaxSize uint64
+	// Cron is a cron expression, in the format of RotationCron, at which
+	// the file is rotated. Empty means the package-level RotationCron.
+	Cron string
+}
+
+// SetRotation sets the rotation settings for the log file of severity s,
+// overriding the package-level defaults. The combined file always uses
+// the defaults. A new Cron takes effect when the current file is rotated.
+func SetRotation(s Severity, cfg RotationConfig) error {
+	if s < debugLog || s > fatalLog {
+		return fmt.Errorf("glog: invalid severity %d", s)
+	}
+	if cfg.Cron != "" {
+		if _, err := parseCron(cfg.Cron); err != nil {
+			return err
+		}
+	}
+	logging.mu.Lock()
+	logging.rotation[s] = cfg
+	logging.mu.Unlock()
+	return nil
+}
+
+// Rotate closes the current log file of severity s and starts a new one,
+// regardless of its size. If no file of that severity has been written
+// yet, the files are created.
+func Rotate(s Severity) error {
+	if s < debugLog || s > fatalLog {
+		return fmt.Errorf("glog: invalid severity %d", s)
+	}
+	logging.mu.Lock()
+	defer logging.unlockAndNotify()
+	if sb, ok := logging.file[s].(*syncBuffer); ok {
+		return sb.rotateFile(logging.now())
+	}
+	return logging.createFiles(s, fileFloor(logging.fileMin()))
+}
+
+// RotateAll starts new files for all log files that are currently open,
+// including the combined file.
+func RotateAll() error {
+	logging.mu.Lock()
+	defer logging.unlockAndNotify()
+	now := logging.now()
+	for s := fatalLog; s >= debugLog; s-- {
+		if sb, ok := logging.file[s].(*syncBuffer); ok {
+			if err := sb.rotateFile(now); err != nil {
+				return err
+			}
+		}
+	}
+	if sb, ok := logging.combined.(*syncBuffer); ok {
+		return sb.rotateFile(now)
+	}
+	return nil
+}
+
 // bufferSize sizes the buffer associated with each log file. It's large
 // so that log records can accumulate without the logging thread blocking
 // on disk I/O. The flushDaemon will block instead.
 const bufferSize = 256 * 1024
 
-// createFiles creates all the log files for severity from sev down to infoLog.
+// createFiles creates the missing log files for severity from sev down to
+// floor.
 // l.mu is held.
-func (l *loggingT) createFiles(sev severity) error {
-	now := time.Now()
-	// Files are created in decreasing severity order, so as soon as we find one
-	// has already been created, we can stop.
-	for s := sev; s >= infoLog && l.file[s] == nil; s-- {
+func (l *loggingT) createFiles(sev, floor Severity) error {
+	now := l.now()
+	for s := sev; s >= floor; s-- {
+		if l.file[s] != nil {
+			continue
+		}
 		sb := &syncBuffer{
 			logger: l,
 			sev:    s,
+			tag:    severityName[s],
 		}
 		if err := sb.rotateFile(now); err != nil {
 			return err
@@ -932,33 +1825,369 @@ func (l *loggingT) createFiles(sev severity) error {
 	return nil
 }
 
-const flushInterval = 5 * time.Second
+// debugVerbosity is the verbosity, logger.Debug, at which DEBUG lines
+// are written to the files by default.
+const debugVerbosity Level = 5
+
+// fileMin returns the lowest severity currently written to the log files:
+// the file threshold, with the default lowered to DEBUG while the
+// verbosity enables debug output.
+func (l *loggingT) fileMin() Severity {
+	min := l.fileThreshold.get()
+	if min == infoLog && l.verbosity.get() >= debugVerbosity {
+		return debugLog
+	}
+	return min
+}
+
+// fileFloor returns the lowest severity that has a log file when min is
+// the lowest severity written to the files. Higher lines cascade down to
+// the INFO file, and to the DEBUG file only while DEBUG lines are written.
+func fileFloor(min Severity) Severity {
+	if min == debugLog {
+		return debugLog
+	}
+	return infoLog
+}
+
+// SetCascade controls whether a line is also written to the files of all
+// lower severities (the default), or only to the file of its own severity.
+// Standard error output is not affected.
+func SetCascade(cascade bool) {
+	logging.mu.Lock()
+	logging.noCascade = !cascade
+	logging.updateReach()
+	logging.mu.Unlock()
+}
+
+// AddSink registers w to receive the lines written to the log file of
+// severity s, formatted exactly as in the file. Sinks receive lines after
+// the file does, in registration order, and also when logging to standard
+// error instead of files. Write errors of sinks are ignored. Sinks are
+// called with the logging lock held, so they must be fast and must not log.
+//
+// The returned function unregisters this registration of w. Calling it
+// again does nothing.
+func AddSink(s Severity, w io.Writer) (remove func(), err error) {
+	if s < debugLog || s > fatalLog {
+		return nil, fmt.Errorf("glog: invalid severity %d", s)
+	}
+	logging.mu.Lock()
+	sk := logging.addSink(s, w)
+	logging.mu.Unlock()
+	logging.updateColors()
+	return func() {
+		logging.mu.Lock()
+		logging.removeSink(s, sk)
+		logging.mu.Unlock()
+		logging.updateColors()
+	}, nil
+}
+
+// sink is the registration of a writer with AddSink. Registrations are
+// told apart by address, as the writers themselves need not be comparable.
+type sink struct {
+	w io.Writer
+}
+
+// addSink registers w for severity s.
+// l.mu is held.
+func (l *loggingT) addSink(s Severity, w io.Writer) *sink {
+	sk := &sink{w}
+	l.sinks[s] = append(l.sinks[s], sk)
+	l.updateReach()
+	return sk
+}
+
+// removeSink unregisters sk, if it is still registered for severity s.
+// l.mu is held.
+func (l *loggingT) removeSink(s Severity, sk *sink) {
+	sinks := l.sinks[s]
+	for i := range sinks {
+		if sinks[i] == sk {
+			l.sinks[s] = append(sinks[:i:i], sinks[i+1:]...)
+			l.updateReach()
+			return
+		}
+	}
+}
+
+// writeSinks writes data, a line of severity s, to the sinks of s and,
+// unless cascading is off, to those of the lower severities.
+// l.mu is held.
+func (l *loggingT) writeSinks(s Severity, data []byte) {
+	for sev := s; sev >= debugLog; sev-- {
+		for _, sk := range l.sinks[sev] {
+			sk.w.Write(data) // ignore error
+		}
+		if l.noCascade {
+			break
+		}
+	}
+}
+
+// SetCollapseDuplicates controls whether a line repeated back to back,
+// with the same severity, location and message, is written only once. The
+// end of the run, or a flush, writes "last message repeated N times"
+// instead of the copies. FATAL lines are never collapsed.
+func SetCollapseDuplicates(collapse bool) {
+	var v uint32
+	if collapse {
+		v = 1
+	}
+	if atomic.SwapUint32(&logging.collapseDups, v) != 0 && !collapse {
+		// End the runs in progress.
+		logging.flushRepeats()
+		logging.repeatsMu.Lock()
+		logging.repeats = [numSeverity]repeatState{}
+		logging.repeatsMu.Unlock()
+	}
+}
+
+// repeatState tracks the last line of a severity and how often it was
+// repeated since it was written.
+type repeatState struct {
+	file  string
+	line  int
+	msg   string
+	count int
+}
+
+// collapse writes buf, a line of severity s, unless it repeats the previous
+// line of s, in which case it is counted and released instead. Otherwise
+// the count of the previous run, if any, is written first.
+func (l *loggingT) collapse(s Severity, buf *buffer, file string, line int, alsoToStderr bool) {
+	msg := buf.Bytes()[buf.hlen:]
+	l.repeatsMu.Lock()
+	last := &l.repeats[s]
+	if last.file == file && last.line == line && last.msg == string(msg) {
+		last.count++
+		l.repeatsMu.Unlock()
+		l.putBuffer(buf)
+		return
+	}
+	atomic.StoreUint32(&l.holdNotify, 1)
+	l.writeRepeats(s, *last)
+	*last = repeatState{file: file, line: line, msg: string(msg)}
+	l.emit(s, buf, file, line, alsoToStderr)
+	l.unlockRepeats()
+}
+
+// flushRepeats writes the counts of all runs of repeated lines in progress.
+func (l *loggingT) flushRepeats() {
+	l.repeatsMu.Lock()
+	atomic.StoreUint32(&l.holdNotify, 1)
+	for s := range l.repeats {
+		l.writeRepeats(Severity(s), l.repeats[s])
+		l.repeats[s].count = 0
+	}
+	l.unlockRepeats()
+}
+
+// unlockRepeats releases l.repeatsMu, then calls the OnRotate callbacks
+// held back while the lines were written.
+// l.repeatsMu is held.
+func (l *loggingT) unlockRepeats() {
+	atomic.StoreUint32(&l.holdNotify, 0)
+	l.repeatsMu.Unlock()
+	l.mu.Lock()
+	l.unlockAndNotify()
+}
+
+// writeRepeats writes how often the line of run was repeated, if at all.
+// l.repeatsMu is held.
+func (l *loggingT) writeRepeats(s Severity, run repeatState) {
+	if run.count == 0 {
+		return
+	}
+	buf := l.formatHeader(s, run.file, run.line)
+	fmt.Fprintf(buf, "last message repeated %d times\n", run.count)
+	l.emit(s, buf, run.file, run.line, false)
+}
+
+// syslogger sends a log message to syslog with the priority matching s.
+type syslogger interface {
+	log(s Severity, msg string) error
+}
+
+// writeSyslog sends a line to syslog. Syslog records the priority and time
+// itself, so text lines are sent as "file:line] msg", without the color
+// codes, severity character and time stamp of the header.
+// l.mu is held.
+func (l *loggingT) writeSyslog(s Severity, buf *buffer, data []byte, file string, line int) {
+	msg := string(data)
+	if !buf.json {
+		msg = file + ":" + strconv.Itoa(line) + "] " + string(buf.Bytes()[buf.hlen:])
+	}
+	l.syslog.log(s, msg) // ignore error
+}
+
+// combinedTag is the file name tag of the combined log file.
+const combinedTag = "ALL"
+
+// SetCombinedFile enables or disables writing every log line, whatever its
+// severity, to a single combined log file (tagged ALL) in addition to the
+// per-severity files. The combined file is rotated like the others.
+// Disabling it flushes and closes the current combined file.
+func SetCombinedFile(enable bool) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.combinedFile = enable
+	if !enable && logging.combined != nil {
+		logging.combined.Flush() // ignore error
+		if sb, ok := logging.combined.(*syncBuffer); ok {
+			sb.file.Close()
+		}
+		logging.combined = nil
+	}
+}
+
+// createCombined creates the combined log file.
+// l.mu is held.
+func (l *loggingT) createCombined() error {
+	sb := &syncBuffer{
+		logger: l,
+		sev:    infoLog,
+		tag:    combinedTag,
+	}
+	if err := sb.rotateFile(l.now()); err != nil {
+		return err
+	}
+	l.combined = sb
+	return nil
+}
+
+// FlushInterval is how often buffered lines are written to the log files.
+// If it is zero, the buffers are flushed after every line instead, so that
+// no line is lost if the process crashes. It is read when the first line
+// is written to the files.
+var FlushInterval = 5 * time.Second
 
-// flushDaemon periodically flushes the log file buffers.
-func (l *loggingT) flushDaemon() {
-	for range time.NewTicker(flushInterval).C {
-		l.lockAndFlushAll()
+// flushDaemon periodically flushes the log file buffers until quit is
+// closed, then closes done.
+func (l *loggingT) flushDaemon(interval time.Duration, quit, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.lockAndFlushAll()
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Shutdown stops the periodic flushing and the asynchronous writer and
+// flushes and closes all log files. Lines logged afterwards are written
+// synchronously and start new files; use Close instead to stop writing
+// files altogether.
+func Shutdown() {
+	logging.shutdown(false)
+}
+
+// Close is like Shutdown but also switches logging to standard error, so
+// that nothing logged afterwards reopens the files or is lost when the
+// process exits. It is safe to call Close more than once.
+func Close() {
+	logging.shutdown(true)
+}
+
+// shutdown drains the sampled, queued and collapsed lines into the files,
+// then flushes and closes them, optionally switching to standard error in
+// the same critical section so that no line falls in between.
+func (l *loggingT) shutdown(toStderr bool) {
+	flushSampled()
+	l.flushRepeats()
+	SetAsync(0)
+	l.stopFlushDaemon()
+
+	l.mu.Lock()
+	l.flushAll()
+	if toStderr {
+		l.toStderr = true
+		l.updateReach()
+	}
+	for s, w := range l.file {
+		if sb, ok := w.(*syncBuffer); ok {
+			sb.file.Close() // ignore error
+			l.file[s] = nil
+		}
+	}
+	if sb, ok := l.combined.(*syncBuffer); ok {
+		sb.file.Close() // ignore error
+		l.combined = nil
+	}
+	l.mu.Unlock()
+
+	// A line logged while draining may have restarted the daemon.
+	l.stopFlushDaemon()
+	if toStderr {
+		l.updateColors()
+	}
+}
+
+// stopFlushDaemon stops the periodic flushing and waits for it to exit.
+func (l *loggingT) stopFlushDaemon() {
+	l.mu.Lock()
+	quit, done := l.flushQuit, l.flushDone
+	l.flushQuit, l.flushDone = nil, nil
+	l.mu.Unlock()
+	if quit != nil {
+		close(quit)
+		<-done
 	}
 }
 
 // lockAndFlushAll is like flushAll but locks l.mu first.
 func (l *loggingT) lockAndFlushAll() {
+	flushSampled()
+	l.flushRepeats()
+	l.syncAsync()
 	l.mu.Lock()
 	l.flushAll()
 	l.mu.Unlock()
 }
 
+// flushBuffers writes the buffered lines to the log files without syncing.
+// l.mu is held.
+func (l *loggingT) flushBuffers() {
+	for _, file := range l.file {
+		if file != nil {
+			file.Flush() // ignore error
+		}
+	}
+	if l.combined != nil {
+		l.combined.Flush() // ignore error
+	}
+}
+
 // flushAll flushes all the logs and attempts to "sync" their data to disk.
 // l.mu is held.
 func (l *loggingT) flushAll() {
 	// Flush from fatal down, in case there's trouble flushing.
-	for s := fatalLog; s >= infoLog; s-- {
+	for s := fatalLog; s >= debugLog; s-- {
 		file := l.file[s]
 		if file != nil {
 			file.Flush() // ignore error
 			file.Sync()  // ignore error
 		}
 	}
+	if l.combined != nil {
+		l.combined.Flush() // ignore error
+		l.combined.Sync()  // ignore error
+	}
+}
+
+// stdLogBinding records how the standard logger is bound to glog. It
+// serializes CopyStandardLogTo, RedirectStdLog and RestoreStandardLog.
+var stdLogBinding struct {
+	sync.Mutex
+	bound    bool
+	sev      Severity
+	prefixes bool // leading severity prefixes are parsed
+	flags    int  // flags of the standard logger before it was bound
 }
 
 // CopyStandardLogTo arranges for messages written to the Go "log" package's
@@ -967,29 +2196,104 @@ func (l *loggingT) flushAll() {
 // or format may break this behavior.
 //
 // Valid names are "INFO", "WARNING", "ERROR", and "FATAL".  If the name is not
-// recognized, CopyStandardLogTo panics.
+// recognized, CopyStandardLogTo panics. It is safe to call concurrently, and
+// binding again to the current severity is a no-op.
 func CopyStandardLogTo(name string) {
 	sev, ok := severityByName(name)
 	if !ok {
 		panic(fmt.Sprintf("log.CopyStandardLogTo(%q): unrecognized severity name", name))
 	}
+	bindStandardLog(sev, false)
+}
+
+// RedirectStdLog is like CopyStandardLogTo, but it reports an unrecognized
+// severity name as an error and raises the severity of messages starting
+// with a "[WARN]", "[WARNING]" or "[ERROR]" prefix, as written by many
+// libraries, to the one named by the prefix. The prefix is removed from the
+// message. Messages are never logged below the named severity.
+func RedirectStdLog(name string) error {
+	sev, ok := severityByName(name)
+	if !ok {
+		return fmt.Errorf("glog: unrecognized severity name %q", name)
+	}
+	bindStandardLog(sev, true)
+	return nil
+}
+
+// bindStandardLog makes the standard logger write to glog at severity sev.
+func bindStandardLog(sev Severity, prefixes bool) {
+	stdLogBinding.Lock()
+	defer stdLogBinding.Unlock()
+	if stdLogBinding.bound && stdLogBinding.sev == sev && stdLogBinding.prefixes == prefixes {
+		return
+	}
+	if !stdLogBinding.bound {
+		stdLogBinding.flags = stdLog.Flags()
+	}
 	// Set a log format that captures the user's file and line:
 	//   d.go:23: message
 	stdLog.SetFlags(stdLog.Lshortfile)
-	stdLog.SetOutput(logBridge(sev))
+	if prefixes {
+		stdLog.SetOutput(prefixLogBridge(sev))
+	} else {
+		stdLog.SetOutput(logBridge(sev))
+	}
+	stdLogBinding.bound, stdLogBinding.sev, stdLogBinding.prefixes = true, sev, prefixes
+}
+
+// RestoreStandardLog undoes CopyStandardLogTo: the Go "log" package's
+// default logger writes to standard error again, with the flags it had
+// before it was bound.
+func RestoreStandardLog() {
+	stdLogBinding.Lock()
+	defer stdLogBinding.Unlock()
+	if !stdLogBinding.bound {
+		return
+	}
+	stdLog.SetOutput(os.Stderr)
+	stdLog.SetFlags(stdLogBinding.flags)
+	stdLogBinding.bound = false
 }
 
 // logBridge provides the Write method that enables CopyStandardLogTo to connect
 // Go's standard logs to the logs provided by this package.
-type logBridge severity
+type logBridge Severity
 
 // Write parses the standard logging line and passes its components to the
-// logger for severity(lb).
+// logger for Severity(lb).
 func (lb logBridge) Write(b []byte) (n int, err error) {
+	writeStdLog(Severity(lb), b, false)
+	return len(b), nil
+}
+
+// prefixLogBridge is the logBridge used by RedirectStdLog.
+type prefixLogBridge Severity
+
+// Write is like logBridge.Write but honors severity prefixes.
+func (lb prefixLogBridge) Write(b []byte) (n int, err error) {
+	writeStdLog(Severity(lb), b, true)
+	return len(b), nil
+}
+
+// stdLogPrefixes maps the message prefixes recognized by RedirectStdLog to
+// severities.
+var stdLogPrefixes = []struct {
+	prefix string
+	sev    Severity
+}{
+	{"[WARN]", warningLog},
+	{"[WARNING]", warningLog},
+	{"[ERROR]", errorLog},
+}
+
+// writeStdLog logs a line written by the standard logger at severity s,
+// or at the severity named by its prefix if prefixes is set.
+func writeStdLog(s Severity, b []byte, prefixes bool) {
 	var (
 		file = "???"
 		line = 1
 		text string
+		err  error
 	)
 	// Split "d.go:23: message" into "d.go", "23", and "message".
 	if parts := bytes.SplitN(b, []byte{':'}, 3); len(parts) != 3 || len(parts[0]) < 1 || len(parts[2]) < 1 {
@@ -1003,10 +2307,59 @@ func (lb logBridge) Write(b []byte) (n int, err error) {
 			line = 1
 		}
 	}
+	if prefixes {
+		for _, p := range stdLogPrefixes {
+			if strings.HasPrefix(text, p.prefix) {
+				text = strings.TrimLeft(text[len(p.prefix):], " ")
+				if p.sev > s {
+					s = p.sev
+				}
+				break
+			}
+		}
+	}
 	// printWithFileLine with alsoToStderr=true, so standard log messages
 	// always appear on standard error.
-	logging.printWithFileLine(severity(lb), file, line, true, text)
-	return len(b), nil
+	logging.printWithFileLine(s, file, line, true, text)
+}
+
+// severityWriter is the io.Writer returned by Writer.
+type severityWriter struct {
+	sev     Severity
+	mu      sync.Mutex
+	partial []byte // unterminated line kept from previous writes
+}
+
+// Writer returns an io.Writer that logs every line written to it at
+// severity s, with a header of its own. It is meant for libraries that
+// report to an io.Writer. Input is split on newlines and a trailing
+// partial line is kept until its newline arrives. Writer panics if s is
+// not a valid severity.
+func Writer(s Severity) io.Writer {
+	if s < debugLog || s > fatalLog {
+		panic(fmt.Sprintf("glog.Writer(%d): invalid severity", s))
+	}
+	return &severityWriter{sev: s}
+}
+
+// Write logs each complete line in p. It never fails.
+func (w *severityWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		// printDepth at depth 0 attributes the line to our caller.
+		logging.printDepth(w.sev, 0, string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	if len(w.partial) == 0 {
+		w.partial = nil
+	}
+	return len(p), nil
 }
 
 // setV computes and remembers the V level for a given PC
@@ -1019,14 +2372,20 @@ func (l *loggingT) setV(pc uintptr) Level {
 	fn := runtime.FuncForPC(pc)
 	file, _ := fn.FileLine(pc)
 	file = trimToImportPath(file)
+	var (
+		level   Level
+		matched bool
+	)
 	for _, filter := range l.vmodule.filter {
-		if filter.pattern.MatchString(file) {
-			l.vmap[pc] = filter.level
-			return filter.level
+		switch {
+		case filter.override && filter.pattern.MatchString(file):
+			level, matched = filter.level, true
+		case !filter.override && !matched && filter.pattern.MatchString(file):
+			level, matched = filter.level, true
 		}
 	}
-	l.vmap[pc] = 0
-	return 0
+	l.vmap[pc] = level
+	return level
 }
 
 // Verbose is a boolean type that implements Infof (like Printf) etc.
@@ -1100,12 +2459,97 @@ func (v Verbose) Infof(format string, args ...interface{}) {
 	}
 }
 
+// InfofFunc is like Infof, but the message is produced by fn, which is
+// only called when v is true. Go evaluates the arguments of Info and its
+// variants even when v is false, so use it for messages that are
+// expensive to build:
+//
+//	glog.V(2).InfofFunc(func() string { return spew.Sdump(block) })
+func (v Verbose) InfofFunc(fn func() string) {
+	if v {
+		logging.print(infoLog, fn())
+	}
+}
+
+// Enabled reports whether a line of severity s would be written anywhere,
+// so that callers on hot paths can skip building an expensive message.
+// It complements V, which does the same for verbose INFO lines.
+func Enabled(s Severity) bool {
+	return logging.enabled(s)
+}
+
+// enabled reports whether a line of severity s would be written to
+// standard error, a log file, a sink, syslog, an OTLP collector or the
+// ring buffer. Like V, it only reads atomically published state.
+func (l *loggingT) enabled(s Severity) bool {
+	if s < debugLog || s > fatalLog {
+		return false
+	}
+	if s == fatalLog {
+		return true // always written to standard error
+	}
+	if r, _ := l.ring.Load().(*ringBuffer); r != nil {
+		return true
+	}
+	if s >= l.stderrThreshold.get() || s >= l.fileMin() {
+		return true
+	}
+	return atomic.LoadUint32(&l.reach)&(1<<uint(s)) != 0
+}
+
+// updateReach recomputes reach after a destination changed.
+// l.mu is held.
+func (l *loggingT) updateReach() {
+	var reach uint32
+	for s := debugLog; s <= fatalLog; s++ {
+		if l.toStderr || l.alsoToStderr || l.syslog != nil || l.otlp != nil {
+			reach |= 1 << uint(s)
+			continue
+		}
+		for sev := s; sev >= debugLog; sev-- {
+			if len(l.sinks[sev]) > 0 {
+				reach |= 1 << uint(s)
+				break
+			}
+			if l.noCascade {
+				break
+			}
+		}
+	}
+	atomic.StoreUint32(&l.reach, reach)
+}
+
+// Debug logs to the DEBUG log. The lines reach the log files only once
+// debug output is enabled, see SetFileThreshold.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func Debug(args ...interface{}) {
+	logging.print(debugLog, args...)
+}
+
+// DebugDepth acts as Debug but uses depth to determine which call frame to log.
+// DebugDepth(0, "msg") is the same as Debug("msg").
+func DebugDepth(depth int, args ...interface{}) {
+	logging.printDepth(debugLog, depth, args...)
+}
+
+// Debugln logs to the DEBUG log.
+// Arguments are handled in the manner of fmt.Println; a newline is appended if missing.
+func Debugln(args ...interface{}) {
+	logging.println(debugLog, args...)
+}
+
+// Debugf logs to the DEBUG log.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func Debugf(format string, args ...interface{}) {
+	logging.printfmt(debugLog, format, args...)
+}
+
 // Separator creates a line, ie ---------------------------------
 func Separator(iterable string) string {
 	return strings.Repeat(iterable, 110)
 }
 
-// Info logs to the INFO log.
+// Info logs to the INFO and DEBUG logs.
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Info(args ...interface{}) {
 	logging.print(infoLog, args...)
@@ -1117,19 +2561,19 @@ func InfoDepth(depth int, args ...interface{}) {
 	logging.printDepth(infoLog, depth, args...)
 }
 
-// Infoln logs to the INFO log.
+// Infoln logs to the INFO and DEBUG logs.
 // Arguments are handled in the manner of fmt.Println; a newline is appended if missing.
 func Infoln(args ...interface{}) {
 	logging.print(infoLog, args...)
 }
 
-// Infof logs to the INFO log.
+// Infof logs to the INFO and DEBUG logs.
 // Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
 func Infof(format string, args ...interface{}) {
 	logging.printfmt(infoLog, format, args...)
 }
 
-// Warning logs to the WARNING and INFO logs.
+// Warning logs to the WARNING, INFO, and DEBUG logs.
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Warning(args ...interface{}) {
 	logging.print(warningLog, args...)
@@ -1141,19 +2585,19 @@ func WarningDepth(depth int, args ...interface{}) {
 	logging.printDepth(warningLog, depth, args...)
 }
 
-// Warningln logs to the WARNING and INFO logs.
+// Warningln logs to the WARNING, INFO, and DEBUG logs.
 // Arguments are handled in the manner of fmt.Println; a newline is appended if missing.
 func Warningln(args ...interface{}) {
 	logging.println(warningLog, args...)
 }
 
-// Warningf logs to the WARNING and INFO logs.
+// Warningf logs to the WARNING, INFO, and DEBUG logs.
 // Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
 func Warningf(format string, args ...interface{}) {
 	logging.printfmt(warningLog, format, args...)
 }
 
-// Error logs to the ERROR, WARNING, and INFO logs.
+// Error logs to the ERROR, WARNING, INFO, and DEBUG logs.
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Error(args ...interface{}) {
 	logging.print(errorLog, args...)
@@ -1165,19 +2609,19 @@ func ErrorDepth(depth int, args ...interface{}) {
 	logging.printDepth(errorLog, depth, args...)
 }
 
-// Errorln logs to the ERROR, WARNING, and INFO logs.
+// Errorln logs to the ERROR, WARNING, INFO, and DEBUG logs.
 // Arguments are handled in the manner of fmt.Println; a newline is appended if missing.
 func Errorln(args ...interface{}) {
 	logging.println(errorLog, args...)
 }
 
-// Errorf logs to the ERROR, WARNING, and INFO logs.
+// Errorf logs to the ERROR, WARNING, INFO, and DEBUG logs.
 // Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
 func Errorf(format string, args ...interface{}) {
 	logging.printfmt(errorLog, format, args...)
 }
 
-// Fatal logs to the FATAL, ERROR, WARNING, and INFO logs,
+// Fatal logs to the FATAL, ERROR, WARNING, INFO, and DEBUG logs,
 // including a stack trace of all running goroutines, then calls os.Exit(255).
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Fatal(args ...interface{}) {
@@ -1190,14 +2634,14 @@ func FatalDepth(depth int, args ...interface{}) {
 	logging.printDepth(fatalLog, depth, args...)
 }
 
-// Fatalln logs to the FATAL, ERROR, WARNING, and INFO logs,
+// Fatalln logs to the FATAL, ERROR, WARNING, INFO, and DEBUG logs,
 // including a stack trace of all running goroutines, then calls os.Exit(255).
 // Arguments are handled in the manner of fmt.Println; a newline is appended if missing.
 func Fatalln(args ...interface{}) {
 	logging.println(fatalLog, args...)
 }
 
-// Fatalf logs to the FATAL, ERROR, WARNING, and INFO logs,
+// Fatalf logs to the FATAL, ERROR, WARNING, INFO, and DEBUG logs,
 // including a stack trace of all running goroutines, then calls os.Exit(255).
 // Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
 func Fatalf(format string, args ...interface{}) {
@@ -1208,7 +2652,7 @@ func Fatalf(format string, args ...interface{}) {
 // It allows Exit and relatives to use the Fatal logs.
 var fatalNoStacks uint32
 
-// Exit logs to the FATAL, ERROR, WARNING, and INFO logs, then calls os.Exit(1).
+// Exit logs to the FATAL, ERROR, WARNING, INFO, and DEBUG logs, then calls os.Exit(1).
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Exit(args ...interface{}) {
 	atomic.StoreUint32(&fatalNoStacks, 1)
@@ -1222,13 +2666,13 @@ func ExitDepth(depth int, args ...interface{}) {
 	logging.printDepth(fatalLog, depth, args...)
 }
 
-// Exitln logs to the FATAL, ERROR, WARNING, and INFO logs, then calls os.Exit(1).
+// Exitln logs to the FATAL, ERROR, WARNING, INFO, and DEBUG logs, then calls os.Exit(1).
 func Exitln(args ...interface{}) {
 	atomic.StoreUint32(&fatalNoStacks, 1)
 	logging.println(fatalLog, args...)
 }
 
-// Exitf logs to the FATAL, ERROR, WARNING, and INFO logs, then calls os.Exit(1).
+// Exitf logs to the FATAL, ERROR, WARNING, INFO, and DEBUG logs, then calls os.Exit(1).
 // Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
 func Exitf(format string, args ...interface{}) {
 	atomic.StoreUint32(&fatalNoStacks, 1)
@@ -0,0 +1,168 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// AsyncDropWhenFull selects what happens to a line logged while the queue
+// of the asynchronous writer is full: if true the line is dropped and
+// counted, otherwise the caller waits for room. It is read by SetAsync.
+var AsyncDropWhenFull = false
+
+// asyncDropped counts the lines dropped because the queue was full. It is
+// a package variable to keep it 64-bit aligned for atomic access.
+var asyncDropped uint64
+
+// asyncLine is a formatted line waiting to be written. A line without a
+// buffer is a marker: flushed is closed once it has been reached.
+type asyncLine struct {
+	s            Severity
+	buf          *buffer
+	file         string
+	line         int
+	alsoToStderr bool
+	flushed      chan struct{}
+}
+
+// asyncWriter hands lines to a single goroutine that writes them, so that
+// callers do not wait for the log files.
+type asyncWriter struct {
+	drop  bool
+	queue chan asyncLine
+	quit  chan struct{}
+	done  chan struct{}
+
+	mu      sync.RWMutex // held for reading while lines are queued
+	stopped bool
+}
+
+// SetAsync makes logging asynchronous: formatted lines are queued and
+// written by a background goroutine, decoupling callers from disk latency.
+// queueSize is the number of lines that may wait; AsyncDropWhenFull decides
+// what happens beyond that. A queueSize of zero or less writes the queued
+// lines and makes logging synchronous again.
+//
+// FATAL lines are always written synchronously after the queue, and Flush
+// writes the queued lines before flushing.
+func SetAsync(queueSize int) {
+	var a *asyncWriter
+	if queueSize > 0 {
+		a = &asyncWriter{
+			drop:  AsyncDropWhenFull,
+			queue: make(chan asyncLine, queueSize),
+			quit:  make(chan struct{}),
+			done:  make(chan struct{}),
+		}
+		go a.loop()
+	}
+	logging.asyncMu.Lock()
+	old, _ := logging.async.Load().(*asyncWriter)
+	logging.async.Store(a)
+	logging.asyncMu.Unlock()
+
+	if old != nil {
+		old.stop()
+	}
+}
+
+// AsyncDropped returns the number of lines dropped because the queue of
+// the asynchronous writer was full.
+func AsyncDropped() uint64 {
+	return atomic.LoadUint64(&asyncDropped)
+}
+
+// enqueue queues a line for the writer goroutine. It reports false if the
+// writer has been stopped, in which case the caller writes the line itself.
+func (a *asyncWriter) enqueue(s Severity, buf *buffer, file string, line int, alsoToStderr bool) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.stopped {
+		return false
+	}
+	l := asyncLine{s: s, buf: buf, file: file, line: line, alsoToStderr: alsoToStderr}
+	if !a.drop {
+		a.queue <- l
+		return true
+	}
+	select {
+	case a.queue <- l:
+	default:
+		atomic.AddUint64(&asyncDropped, 1)
+		logging.putBuffer(buf)
+	}
+	return true
+}
+
+// sync waits until the lines queued so far have been written.
+func (a *asyncWriter) sync() {
+	a.mu.RLock()
+	if a.stopped {
+		a.mu.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	a.queue <- asyncLine{flushed: flushed}
+	a.mu.RUnlock()
+	<-flushed
+}
+
+// stop writes the queued lines and terminates the writer goroutine.
+func (a *asyncWriter) stop() {
+	a.mu.Lock()
+	a.stopped = true
+	a.mu.Unlock()
+	close(a.quit)
+	<-a.done
+}
+
+func (a *asyncWriter) loop() {
+	defer close(a.done)
+	for {
+		select {
+		case l := <-a.queue:
+			a.write(l)
+		case <-a.quit:
+			for {
+				select {
+				case l := <-a.queue:
+					a.write(l)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *asyncWriter) write(l asyncLine) {
+	if l.buf == nil {
+		close(l.flushed)
+		return
+	}
+	logging.writeLine(l.s, l.buf, l.file, l.line, l.alsoToStderr)
+}
+
+// syncAsync waits until the lines queued by the asynchronous writer, if
+// any, have been written.
+func (l *loggingT) syncAsync() {
+	if a, _ := l.async.Load().(*asyncWriter); a != nil {
+		a.sync()
+	}
+}
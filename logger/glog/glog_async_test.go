@@ -0,0 +1,167 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that queued lines are written in order and flushed by Flush.
+func TestAsync(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetStacktraceThreshold(FatalSeverity)
+	defer SetAsync(0)
+
+	SetAsync(16)
+	for i := 0; i < 100; i++ {
+		Infof("line %d", i)
+	}
+	SetStacktraceThreshold(ErrorSeverity)
+	Error("with stack")
+	Flush()
+
+	logging.mu.Lock()
+	info, errs := contents(infoLog), contents(errorLog)
+	logging.mu.Unlock()
+	last := -1
+	for _, line := range strings.Split(strings.TrimSpace(info), "\n") {
+		var n int
+		if i := strings.Index(line, "line "); i >= 0 {
+			fmt.Sscanf(line[i:], "line %d", &n)
+			if n != last+1 {
+				t.Fatalf("line %d follows line %d", n, last)
+			}
+			last = n
+		}
+	}
+	if last != 99 {
+		t.Errorf("last line written is %d, want 99", last)
+	}
+	// The stack trace is that of the logging goroutine.
+	if !strings.Contains(errs, "TestAsync") {
+		t.Errorf("stack trace of the caller missing:\n%s", errs)
+	}
+}
+
+// Test that -log_backtrace_at applies to queued lines.
+func TestAsyncBacktraceAt(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetAsync(0)
+	defer logging.traceLocation.Set("")
+
+	SetAsync(16)
+	_, file, line, _ := runtime.Caller(0)
+	infoLine := fmt.Sprintf("%s:%d", filepath.Base(file), line+5)
+	if err := logging.traceLocation.Set(infoLine); err != nil {
+		t.Fatal(err)
+	}
+	Info("traced")
+	Flush()
+
+	logging.mu.Lock()
+	info := contents(infoLog)
+	logging.mu.Unlock()
+	if !strings.Contains(info, "] traced\ngoroutine ") || !strings.Contains(info, "TestAsyncBacktraceAt") {
+		t.Errorf("no stack trace for %s:\n%s", infoLine, info)
+	}
+}
+
+// Test that an OnRotate callback may flush and log while SetAsync is in
+// effect.
+func TestAsyncOnRotate(t *testing.T) {
+	setFlags()
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 512
+	defer func() {
+		onRotate.Lock()
+		onRotate.fns = nil
+		onRotate.Unlock()
+	}()
+	defer SetAsync(0) // Stop the writer before restoring MaxSize.
+
+	Info("x") // Be sure we have a file.
+	var once sync.Once
+	rotated := make(chan struct{})
+	OnRotate(func(oldPath, newPath string, s Severity) {
+		if s == infoLog {
+			once.Do(func() {
+				Flush()
+				Info("rotated")
+				close(rotated)
+			})
+		}
+	})
+	SetAsync(16)
+	Info(strings.Repeat("x", int(MaxSize))) // force a rollover
+	select {
+	case <-rotated:
+	case <-time.After(10 * time.Second):
+		t.Fatal("flushing from OnRotate deadlocked")
+	}
+	Flush()
+}
+
+// Test that lines are dropped and counted when the queue is full.
+func TestAsyncDrop(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { AsyncDropWhenFull = previous }(AsyncDropWhenFull)
+	defer SetAsync(0)
+
+	AsyncDropWhenFull = true
+	SetAsync(1)
+	dropped := AsyncDropped()
+
+	// Holding the lock stalls the writer goroutine.
+	logging.mu.Lock()
+	for i := 0; i < 10; i++ {
+		Info("storm")
+	}
+	logging.mu.Unlock()
+	if AsyncDropped() == dropped {
+		t.Error("no lines dropped")
+	}
+	SetAsync(0)
+	Info("sync")
+	if !contains(infoLog, "sync", t) {
+		t.Error("line not written after SetAsync(0)")
+	}
+}
+
+func benchmarkInfo(b *testing.B, queueSize int) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetAsync(0)
+	SetAsync(queueSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Info("benchmark")
+	}
+	Flush()
+}
+
+func BenchmarkInfo(b *testing.B)      { benchmarkInfo(b, 0) }
+func BenchmarkInfoAsync(b *testing.B) { benchmarkInfo(b, 1024) }
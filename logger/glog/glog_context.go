@@ -0,0 +1,41 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Propagation of trace IDs through contexts.
+
+package glog
+
+import "context"
+
+// traceIDKey is the context key of the trace ID stored by WithTraceID.
+type traceIDKey struct{}
+
+// WithTraceID returns a copy of ctx carrying the trace ID id, which the
+// FieldLogger returned by FromContext adds to every line.
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, traceIDKey{}, id)
+}
+
+// FromContext returns a FieldLogger whose lines carry the trace ID stored
+// in ctx by WithTraceID as the "trace" field. Without a trace ID it logs
+// plain lines and does not allocate.
+func FromContext(ctx context.Context) FieldLogger {
+	id, ok := ctx.Value(traceIDKey{}).(string)
+	if !ok {
+		return FieldLogger{}
+	}
+	return FieldLogger{[]field{{"trace", id}}}
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Test that the trace ID of a context is added to lines.
+func TestFromContext(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	ctx := WithTraceID(context.Background(), "abc123")
+	FromContext(ctx).Info("traced")
+	if !strings.HasSuffix(contents(infoLog), "] traced trace=abc123\n") {
+		t.Errorf("traced line is %q", contents(infoLog))
+	}
+	logging.newBuffers()
+	FromContext(context.Background()).Info("plain")
+	if !strings.HasSuffix(contents(infoLog), "] plain\n") {
+		t.Errorf("plain line is %q", contents(infoLog))
+	}
+
+	// The line number is that of the caller.
+	logging.newBuffers()
+	_, _, line, _ := runtime.Caller(0)
+	func() { FromContext(ctx).InfoDepth(1, "depth") }()
+	if want := fmt.Sprintf("glog_context_test.go:%d] depth", line+1); !strings.Contains(contents(infoLog), want) {
+		t.Errorf("line is %q, want it to contain %q", contents(infoLog), want)
+	}
+}
+
+// Test that contexts without a trace ID do not allocate.
+func TestFromContextNoAlloc(t *testing.T) {
+	ctx := context.Background()
+	if n := testing.AllocsPerRun(100, func() { FromContext(ctx) }); n != 0 {
+		t.Errorf("FromContext allocates %v times without a trace ID", n)
+	}
+}
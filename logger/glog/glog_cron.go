@@ -0,0 +1,142 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Cron schedules for time-based log rotation.
+
+package glog
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression. Each field is a
+// bit set of the values it allows.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record whether the day fields were "*". As in
+	// cron, if both are restricted a day matching either one is allowed.
+	domStar, dowStar bool
+}
+
+// parseCron parses a cron expression of the form "minute hour
+// day-of-month month day-of-week". Fields are "*", numbers, ranges a-b
+// and lists of them separated by commas; "*" and ranges may be followed
+// by a step /n. Sunday is 0 or 7.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q has %d fields, want 5", expr, len(fields))
+	}
+	var (
+		c   cronSchedule
+		err error
+	)
+	if c.minute, _, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, _, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, c.domStar, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, _, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, c.dowStar, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1 // Sunday
+	}
+	return &c, nil
+}
+
+// parseCronField parses a field allowing values from min to max. It also
+// reports whether the field is "*".
+func parseCronField(field string, min, max int) (bits uint64, star bool, err error) {
+	for _, part := range strings.Split(field, ",") {
+		lo, hi, step := min, max, 1
+		rng := part
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, false, fmt.Errorf("bad step in cron field %q", field)
+			}
+		}
+		switch {
+		case rng == "*":
+			star = field == "*"
+		case strings.Contains(rng, "-"):
+			i := strings.IndexByte(rng, '-')
+			lo, err = strconv.Atoi(rng[:i])
+			if err == nil {
+				hi, err = strconv.Atoi(rng[i+1:])
+			}
+		default:
+			lo, err = strconv.Atoi(rng)
+			if err == nil && step == 1 {
+				hi = lo
+			}
+		}
+		if err != nil || lo < min || hi > max || lo > hi {
+			return 0, false, fmt.Errorf("bad cron field %q, want values from %d to %d", field, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, star, nil
+}
+
+// errNoCronTime is returned by next if the schedule never fires.
+var errNoCronTime = errors.New("cron expression never matches")
+
+// dayMatches reports whether the schedule allows the day of t.
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time after t matching the schedule.
+func (c *cronSchedule) next(t time.Time) (time.Time, error) {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+	// Schedules such as February 30 never match; give up eventually.
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, nil
+		}
+	}
+	return time.Time{}, errNoCronTime
+}
@@ -0,0 +1,212 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Structured key/value fields.
+
+package glog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereumproject/go-ethereum/common"
+	"github.com/ethereumproject/go-ethereum/crypto/sha3"
+)
+
+// field is a key/value pair appended to log lines.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// FieldLogger logs lines carrying a set of key/value fields. In FormatText
+// the fields follow the message as space-separated key=value pairs; in
+// FormatJSON they are written as the "fields" object. A FieldLogger is
+// immutable, so it is safe to share between goroutines.
+type FieldLogger struct {
+	fields []field // sorted by key
+}
+
+// WithFields returns a FieldLogger whose lines carry fields.
+func WithFields(fields map[string]interface{}) FieldLogger {
+	return FieldLogger{}.WithFields(fields)
+}
+
+// WithFields returns a FieldLogger whose lines carry the fields of f and
+// fields. Keys in fields override those of f.
+func (f FieldLogger) WithFields(fields map[string]interface{}) FieldLogger {
+	merged := make([]field, 0, len(f.fields)+len(fields))
+	for _, fld := range f.fields {
+		if _, ok := fields[fld.key]; !ok {
+			merged = append(merged, fld)
+		}
+	}
+	for key, value := range fields {
+		merged = append(merged, field{key, value})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].key < merged[j].key })
+	return FieldLogger{merged}
+}
+
+// Info logs to the INFO and DEBUG logs.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func (f FieldLogger) Info(args ...interface{}) {
+	logging.printFields(infoLog, 0, f.fields, fmt.Sprint(args...))
+}
+
+// InfoDepth acts as Info but uses depth to determine which call frame to log.
+// InfoDepth(0, "msg") is the same as Info("msg").
+func (f FieldLogger) InfoDepth(depth int, args ...interface{}) {
+	logging.printFields(infoLog, depth, f.fields, fmt.Sprint(args...))
+}
+
+// Infof logs to the INFO and DEBUG logs.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func (f FieldLogger) Infof(format string, args ...interface{}) {
+	logging.printFields(infoLog, 0, f.fields, fmt.Sprintf(format, args...))
+}
+
+// Warning logs to the WARNING, INFO, and DEBUG logs.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func (f FieldLogger) Warning(args ...interface{}) {
+	logging.printFields(warningLog, 0, f.fields, fmt.Sprint(args...))
+}
+
+// Warningf logs to the WARNING, INFO, and DEBUG logs.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func (f FieldLogger) Warningf(format string, args ...interface{}) {
+	logging.printFields(warningLog, 0, f.fields, fmt.Sprintf(format, args...))
+}
+
+// Error logs to the ERROR, WARNING, INFO, and DEBUG logs.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func (f FieldLogger) Error(args ...interface{}) {
+	logging.printFields(errorLog, 0, f.fields, fmt.Sprint(args...))
+}
+
+// Errorf logs to the ERROR, WARNING, INFO, and DEBUG logs.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func (f FieldLogger) Errorf(format string, args ...interface{}) {
+	logging.printFields(errorLog, 0, f.fields, fmt.Sprintf(format, args...))
+}
+
+// printFields logs msg followed by fields. depth is interpreted as by
+// printDepth.
+func (l *loggingT) printFields(s Severity, depth int, fields []field, msg string) {
+	buf, file, line := l.header(s, depth)
+	l.outputFields(s, buf, file, line, fields, msg)
+}
+
+// printFieldsWithFileLine is like printFields but uses the provided file
+// and line for the header.
+func (l *loggingT) printFieldsWithFileLine(s Severity, file string, line int, fields []field, msg string) {
+	buf := l.formatHeader(s, file, line)
+	l.outputFields(s, buf, file, line, fields, msg)
+}
+
+// outputFields completes buf with msg and fields and writes it.
+func (l *loggingT) outputFields(s Severity, buf *buffer, file string, line int, fields []field, msg string) {
+	buf.WriteString(strings.TrimSuffix(msg, "\n"))
+	buf.fields = fields
+	if !buf.json {
+		for _, fld := range fields {
+			buf.WriteByte(' ')
+			buf.WriteString(fld.key)
+			buf.WriteByte('=')
+			buf.WriteString(textFieldValue(fld.value))
+		}
+	}
+	buf.WriteByte('\n')
+	l.output(s, buf, file, line, false)
+}
+
+// textFieldValue formats a field value for FormatText, quoting it if it
+// would otherwise be ambiguous.
+func textFieldValue(value interface{}) string {
+	if s, ok := canonicalFieldValue(value); ok {
+		return s
+	}
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// canonicalFieldValue returns the canonical text of the values logged
+// throughout go-ethereum, so that they read the same in every line:
+// addresses in checksummed hex, hashes and byte slices in 0x-prefixed hex
+// and big integers in decimal. It reports false for other values.
+func canonicalFieldValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case common.Address:
+		return checksumAddress(v), true
+	case common.Hash:
+		return v.Hex(), true
+	case []byte:
+		return "0x" + hex.EncodeToString(v), true
+	case *big.Int:
+		if v == nil {
+			return "<nil>", true
+		}
+		return v.String(), true
+	}
+	return "", false
+}
+
+// checksumAddress returns the EIP-55 mixed-case hex encoding of a.
+func checksumAddress(a common.Address) string {
+	digits := []byte(hex.EncodeToString(a[:]))
+	sha := sha3.NewKeccak256()
+	sha.Write(digits)
+	hash := sha.Sum(nil)
+	for i, c := range digits {
+		nibble := hash[i/2]
+		if i%2 == 0 {
+			nibble >>= 4
+		}
+		if c > '9' && nibble&0xf >= 8 {
+			digits[i] -= 'a' - 'A'
+		}
+	}
+	return "0x" + string(digits)
+}
+
+// writeJSONFields writes fields as a JSON object. Values with a canonical
+// text and values that cannot be encoded as JSON are written as strings.
+func (buf *buffer) writeJSONFields(fields []field) {
+	buf.WriteByte('{')
+	for i, fld := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.writeJSONString(fld.key)
+		buf.WriteByte(':')
+		if s, ok := canonicalFieldValue(fld.value); ok {
+			buf.writeJSONString(s)
+		} else if enc, err := json.Marshal(fld.value); err == nil {
+			buf.Write(enc)
+		} else {
+			buf.writeJSONString(fmt.Sprint(fld.value))
+		}
+	}
+	buf.WriteByte('}')
+}
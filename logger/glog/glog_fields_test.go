@@ -0,0 +1,143 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereumproject/go-ethereum/common"
+)
+
+// Test that fields are appended to text lines and inherited by children.
+func TestWithFields(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	parent := WithFields(map[string]interface{}{"peer": "abc", "block": 42})
+	child := parent.WithFields(map[string]interface{}{"block": 43, "reason": "bad hash"})
+
+	parent.Info("parent")
+	if !strings.HasSuffix(contents(infoLog), "] parent block=42 peer=abc\n") {
+		t.Errorf("parent line is %q", contents(infoLog))
+	}
+	logging.newBuffers()
+	child.Warningf("child %d", 1)
+	if !strings.HasSuffix(contents(warningLog), `] child 1 block=43 peer=abc reason="bad hash"`+"\n") {
+		t.Errorf("child line is %q", contents(warningLog))
+	}
+	// The parent is not modified by its child.
+	logging.newBuffers()
+	parent.Error("again")
+	if !strings.HasSuffix(contents(errorLog), "] again block=42 peer=abc\n") {
+		t.Errorf("parent line after child is %q", contents(errorLog))
+	}
+}
+
+// Test that fields are written as an object in JSON lines.
+func TestWithFieldsJSON(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetOutputFormat(FormatText)
+	SetOutputFormat(FormatJSON)
+
+	WithFields(map[string]interface{}{"peer": "abc", "block": 42}).Info("test")
+	var rec struct {
+		Msg    string
+		Fields map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(contents(infoLog)), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", contents(infoLog), err)
+	}
+	if rec.Msg != "test" || rec.Fields["peer"] != "abc" || rec.Fields["block"] != float64(42) {
+		t.Errorf("bad record %+v", rec)
+	}
+
+	// Lines without fields have no fields object.
+	logging.newBuffers()
+	Info("plain")
+	if strings.Contains(contents(infoLog), `"fields"`) {
+		t.Errorf("plain line has fields: %q", contents(infoLog))
+	}
+}
+
+// canonicalValues are field values with a canonical text and that text.
+var canonicalValues = []struct {
+	value interface{}
+	want  string
+}{
+	{common.HexToAddress("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"), "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"},
+	{common.HexToHash("0x01"), "0x0000000000000000000000000000000000000000000000000000000000000001"},
+	{[]byte{0xde, 0xad, 0xbe, 0xef}, "0xdeadbeef"},
+	{new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil), "100000000000000000000"},
+	{(*big.Int)(nil), "<nil>"},
+}
+
+// Test that go-ethereum types are rendered canonically in text lines.
+func TestFieldValuesText(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	for _, test := range canonicalValues {
+		logging.newBuffers()
+		WithFields(map[string]interface{}{"v": test.value}).Info("value")
+		if want := "] value v=" + test.want + "\n"; !strings.HasSuffix(contents(infoLog), want) {
+			t.Errorf("%T: line is %q, want suffix %q", test.value, contents(infoLog), want)
+		}
+	}
+}
+
+// Test that go-ethereum types are rendered canonically in JSON lines.
+func TestFieldValuesJSON(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetOutputFormat(FormatText)
+	SetOutputFormat(FormatJSON)
+
+	for _, test := range canonicalValues {
+		logging.newBuffers()
+		WithFields(map[string]interface{}{"v": test.value}).Info("value")
+		var rec struct {
+			Fields map[string]interface{}
+		}
+		if err := json.Unmarshal([]byte(contents(infoLog)), &rec); err != nil {
+			t.Fatalf("invalid JSON %q: %v", contents(infoLog), err)
+		}
+		if rec.Fields["v"] != test.want {
+			t.Errorf("%T: field is %#v, want %q", test.value, rec.Fields["v"], test.want)
+		}
+	}
+}
+
+// Test that lines logged with fields report the caller's location.
+func TestWithFieldsDepth(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	f := WithFields(map[string]interface{}{"k": "v"})
+	f.Info("direct")
+	if !strings.Contains(contents(infoLog), " logger/glog/glog_fields_test.go:") {
+		t.Errorf("wrong location in %q", contents(infoLog))
+	}
+	logging.newBuffers()
+	func() { f.InfoDepth(1, "depth") }()
+	if !strings.Contains(contents(infoLog), " logger/glog/glog_fields_test.go:") {
+		t.Errorf("wrong location for InfoDepth in %q", contents(infoLog))
+	}
+}
@@ -21,9 +21,12 @@ package glog
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -32,6 +35,20 @@ import (
 // MaxSize is the maximum size of a log file in bytes.
 var MaxSize uint64 = 1024 * 1024 * 1800
 
+// MaxBackups is the maximum number of rotated log files of each severity
+// kept in the log directory; older ones are deleted after each rotation.
+// A compressed (.gz) copy counts as one rotated file with its original,
+// if both are present. Zero keeps all files.
+// Files created by other processes since this one started may still be in
+// use; they are neither counted nor deleted.
+var MaxBackups int
+
+// MaxTotalSize is the maximum combined size in bytes of the log files of
+// all severities in the log directory; the oldest rotated files are deleted
+// after each rotation until the rest fit. Zero means no limit. As with
+// MaxBackups, recent files of other processes are left out.
+var MaxTotalSize uint64
+
 // logDirs lists the candidate directories for new log files.
 var logDirs []string
 
@@ -53,25 +70,82 @@ func createLogDirs() {
 }
 
 var (
-	pid      = os.Getpid()
+	pid = os.Getpid()
+	// startTime is when the process started. Log files of other processes
+	// created since then are never pruned, as those processes may be
+	// running.
+	startTime = time.Now()
+
+	// The components of log file names. They are guarded by logging.mu.
 	program  = filepath.Base(os.Args[0])
 	host     = "unknownhost"
 	userName = "unknownuser"
 )
 
 func init() {
+	host = detectHost()
+	userName = detectUser()
+}
+
+// detectHost returns the short name of this machine.
+func detectHost() string {
 	h, err := os.Hostname()
-	if err == nil {
-		host = shortHostname(h)
+	if err != nil {
+		return "unknownhost"
 	}
+	return shortHostname(h)
+}
 
+// detectUser returns the name of the user running this process.
+func detectUser() string {
 	current, err := user.Current()
-	if err == nil {
-		userName = current.Username
+	if err != nil {
+		return "unknownuser"
 	}
-
 	// Sanitize userName since it may contain filepath separators on Windows.
-	userName = strings.Replace(userName, `\`, "_", -1)
+	return strings.Replace(current.Username, `\`, "_", -1)
+}
+
+// fileNameReplacer replaces the path separators of names used in log file
+// names.
+var fileNameReplacer = strings.NewReplacer("/", "_", `\`, "_")
+
+// SetProgramName sets the program name starting the names of log files
+// created afterwards. An empty name restores the base name of the binary.
+func SetProgramName(name string) {
+	if name == "" {
+		name = filepath.Base(os.Args[0])
+	}
+	name = fileNameReplacer.Replace(name)
+	logging.mu.Lock()
+	program = name
+	logging.mu.Unlock()
+}
+
+// SetHost sets the host name used in the names of log files created
+// afterwards, e.g. when the detected one is a meaningless container ID.
+// Like the detected name it is truncated at the first period. An empty
+// name restores the detected one.
+func SetHost(name string) {
+	if name == "" {
+		name = detectHost()
+	}
+	name = shortHostname(fileNameReplacer.Replace(name))
+	logging.mu.Lock()
+	host = name
+	logging.mu.Unlock()
+}
+
+// SetUser sets the user name used in the names of log files created
+// afterwards. An empty name restores the detected one.
+func SetUser(name string) {
+	if name == "" {
+		name = detectUser()
+	}
+	name = fileNameReplacer.Replace(name)
+	logging.mu.Lock()
+	userName = name
+	logging.mu.Unlock()
 }
 
 // shortHostname returns its argument, truncating at the first period.
@@ -83,10 +157,70 @@ func shortHostname(hostname string) string {
 	return hostname
 }
 
+// instanceID, if non-empty, replaces the pid in log file names.
+// It is guarded by logging.mu.
+var instanceID string
+
+// SetInstanceID makes log file names end in id, e.g. a container instance
+// ID, instead of the process ID, which is meaningless in orchestrated
+// environments. An empty id restores the process ID.
+func SetInstanceID(id string) {
+	// Sanitize id since it ends up in a file name.
+	id = fileNameReplacer.Replace(id)
+	logging.mu.Lock()
+	instanceID = id
+	logging.mu.Unlock()
+}
+
+// processID returns the identifier of this process used in log file names.
+// logging.mu is held.
+func processID() string {
+	if instanceID != "" {
+		return instanceID
+	}
+	return strconv.Itoa(pid)
+}
+
+// CurrentLogFile returns the absolute path of the file currently receiving
+// the lines of the named severity, e.g. "INFO". It fails if no line of
+// that severity has been written to a file yet.
+func CurrentLogFile(severity string) (string, error) {
+	s, ok := severityByName(severity)
+	if !ok {
+		return "", fmt.Errorf("glog: unknown severity %q", severity)
+	}
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	sb, ok := logging.file[s].(*syncBuffer)
+	if !ok || sb.file == nil {
+		return "", fmt.Errorf("glog: no %s log file open", severityName[s])
+	}
+	return filepath.Abs(sb.file.Name())
+}
+
+// LogDir returns the directory the log files are written to. Before any
+// file is created it returns the first directory that will be tried.
+func LogDir() string {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	for _, w := range logging.file {
+		if sb, ok := w.(*syncBuffer); ok && sb.file != nil {
+			if dir, err := filepath.Abs(filepath.Dir(sb.file.Name())); err == nil {
+				return dir
+			}
+		}
+	}
+	onceLogDirs.Do(createLogDirs)
+	if len(logDirs) == 0 {
+		return ""
+	}
+	return logDirs[0]
+}
+
 // logName returns a new log file name containing tag, with start time t, and
 // the name for the symlink for tag.
 func logName(tag string, t time.Time) (name, link string) {
-	name = fmt.Sprintf("%s.%s.%s.log.%s.%04d%02d%02d-%02d%02d%02d.%d",
+	name = fmt.Sprintf("%s.%s.%s.log.%s.%04d%02d%02d-%02d%02d%02d.%s",
 		program,
 		host,
 		userName,
@@ -97,16 +231,24 @@ func logName(tag string, t time.Time) (name, link string) {
 		t.Hour(),
 		t.Minute(),
 		t.Second(),
-		pid)
+		processID())
 	return name, program + "." + tag
 }
 
 var onceLogDirs sync.Once
 
+// maxCollisions bounds the number of disambiguated names create tries when
+// a log file name is already taken.
+const maxCollisions = 100
+
 // create creates a new log file and returns the file and its filename, which
 // contains tag ("INFO", "FATAL", etc.) and t.  If the file is created
 // successfully, create also attempts to update the symlink for that tag, ignoring
 // errors.
+//
+// Files are created exclusively, so that processes starting at the same
+// time never share or truncate each other's files. If the name is taken,
+// a numeric suffix is appended to it.
 func create(tag string, t time.Time) (f *os.File, filename string, err error) {
 	onceLogDirs.Do(createLogDirs)
 	if len(logDirs) == 0 {
@@ -115,15 +257,208 @@ func create(tag string, t time.Time) (f *os.File, filename string, err error) {
 	name, link := logName(tag, t)
 	var lastErr error
 	for _, dir := range logDirs {
-		fname := filepath.Join(dir, name)
-		f, err := os.Create(fname)
+		f, fname, err := createExclusive(dir, name)
 		if err == nil {
 			symlink := filepath.Join(dir, link)
-			os.Remove(symlink)        // ignore err
-			os.Symlink(name, symlink) // ignore err
+			os.Remove(symlink)                        // ignore err
+			os.Symlink(filepath.Base(fname), symlink) // ignore err
 			return f, fname, nil
 		}
 		lastErr = err
 	}
 	return nil, "", fmt.Errorf("log: cannot create log: %v", lastErr)
 }
+
+// createExclusive creates name in dir, failing if it already exists. On a
+// collision it retries with the suffixes .1, .2 and so on.
+func createExclusive(dir, name string) (*os.File, string, error) {
+	fname := filepath.Join(dir, name)
+	for i := 1; ; i++ {
+		f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			return f, fname, nil
+		}
+		if !os.IsExist(err) || i > maxCollisions {
+			return nil, "", err
+		}
+		fname = filepath.Join(dir, fmt.Sprintf("%s.%d", name, i))
+	}
+}
+
+// logFilePrefix returns the prefix shared by the names of the log files of
+// this program tagged tag, up to the time stamp.
+// logging.mu is held.
+func logFilePrefix(tag string) string {
+	return fmt.Sprintf("%s.%s.%s.log.%s.", program, host, userName, tag)
+}
+
+// timestampLayout is the layout of the time stamp in log file names.
+const timestampLayout = "20060102-150405"
+
+// extractTimestamp returns the time stamp embedded in the log file name
+// following prefix. It reports false if name does not have that form.
+func extractTimestamp(name, prefix string) (time.Time, bool) {
+	if !strings.HasPrefix(name, prefix) || len(name) < len(prefix)+len(timestampLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(timestampLayout, name[len(prefix):len(prefix)+len(timestampLayout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// logFile is a log file found in a log directory.
+type logFile struct {
+	name string
+	time time.Time
+	size uint64
+}
+
+// oldLogFiles returns the log files in dir whose names start with prefix,
+// except current, oldest first. Files without a time stamp are skipped, as
+// are those of other processes that may still be running.
+// logging.mu is held.
+func oldLogFiles(dir, prefix, current string) ([]logFile, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []logFile
+	for _, fi := range infos {
+		if fi.Name() == current || !fi.Mode().IsRegular() {
+			continue
+		}
+		t, ok := extractTimestamp(fi.Name(), prefix)
+		if !ok {
+			continue
+		}
+		if !ownLogFile(fi.Name()[len(prefix)+len(timestampLayout):]) && !t.Before(startTime.Truncate(time.Second)) {
+			continue
+		}
+		files = append(files, logFile{fi.Name(), t, uint64(fi.Size())})
+	}
+	sortLogFiles(files)
+	return files, nil
+}
+
+// ownLogFile reports whether a log file was created by this process, given
+// the part of its name following the time stamp: the process identifier,
+// possibly followed by a disambiguating or compression suffix.
+// logging.mu is held.
+func ownLogFile(suffix string) bool {
+	for _, id := range []string{instanceID, strconv.Itoa(pid)} {
+		if id == "" || !strings.HasPrefix(suffix, "."+id) {
+			continue
+		}
+		if rest := suffix[len(id)+1:]; rest == "" || rest[0] == '.' {
+			return true
+		}
+	}
+	return false
+}
+
+// sortLogFiles sorts files oldest first. Files with the same time stamp
+// are sorted by name, so that the order is deterministic.
+func sortLogFiles(files []logFile) {
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].time.Equal(files[j].time) {
+			return files[i].time.Before(files[j].time)
+		}
+		return files[i].name < files[j].name
+	})
+}
+
+// pruneBackups deletes the oldest log files tagged tag in the directory of
+// current, the file just created, until at most MaxBackups others remain.
+// Files of other processes of the same program share the name prefix and
+// are counted too, unless they were created after this process started.
+func pruneBackups(tag, current string) error {
+	if MaxBackups <= 0 {
+		return nil
+	}
+	files, err := oldLogFiles(filepath.Dir(current), logFilePrefix(tag), filepath.Base(current))
+	if err != nil {
+		return err
+	}
+	// A file and its compressed copy are one backup, keyed by the name of
+	// the original.
+	var backups []string
+	names := make(map[string][]string)
+	for _, f := range files {
+		key := strings.TrimSuffix(f.name, ".gz")
+		if _, ok := names[key]; !ok {
+			backups = append(backups, key)
+		}
+		names[key] = append(names[key], f.name)
+	}
+	for ; len(backups) > MaxBackups; backups = backups[1:] {
+		for _, name := range names[backups[0]] {
+			if err := os.Remove(filepath.Join(filepath.Dir(current), name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneTotalSize deletes the oldest log files of any tag in dir until the
+// total size of the log files is at most MaxTotalSize. The files named in
+// open are in use; they count towards the total but are never deleted.
+func pruneTotalSize(dir string, open map[string]bool) error {
+	if MaxTotalSize == 0 {
+		return nil
+	}
+	var files []logFile
+	for _, tag := range append(severityName[:], combinedTag) {
+		tagged, err := oldLogFiles(dir, logFilePrefix(tag), "")
+		if err != nil {
+			return err
+		}
+		files = append(files, tagged...)
+	}
+	sortLogFiles(files)
+
+	var total uint64
+	for _, f := range files {
+		total += f.size
+	}
+	for _, f := range files {
+		if total <= MaxTotalSize {
+			break
+		}
+		if open[f.name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+// prune applies MaxBackups and MaxTotalSize after fname, tagged tag, was
+// created, recording any error for LastPruneError.
+// l.mu is held.
+func (l *loggingT) prune(tag, fname string) {
+	err := pruneBackups(tag, fname)
+	if err == nil {
+		open := map[string]bool{filepath.Base(fname): true}
+		for _, w := range append(l.file[:], l.combined) {
+			if sb, ok := w.(*syncBuffer); ok && sb.file != nil {
+				open[filepath.Base(sb.file.Name())] = true
+			}
+		}
+		err = pruneTotalSize(filepath.Dir(fname), open)
+	}
+	l.pruneErr = err
+}
+
+// LastPruneError returns the error, if any, of the last attempt to delete
+// old log files under MaxBackups or MaxTotalSize.
+func LastPruneError() error {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	return logging.pruneErr
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// JSON formatting of log lines.
+
+package glog
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Format selects how log lines are written.
+type Format uint32
+
+const (
+	// FormatText writes the traditional Lmmdd hh:mm:ss.uuuuuu file:line] header.
+	FormatText Format = iota
+	// FormatJSON writes one JSON object per line, with the fields severity,
+	// time, file, line, pid (see SetShowPID) and msg, and fields for lines logged through
+	// a FieldLogger.
+	FormatJSON
+)
+
+// jsonTimeFormat is the layout of the time field of JSON lines.
+const jsonTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// SetOutputFormat selects the format of log lines. The default is FormatText.
+// Header parts and severity colors only apply to FormatText.
+func SetOutputFormat(f Format) {
+	atomic.StoreUint32(&logging.format, uint32(f))
+}
+
+// SetShowPID selects whether JSON lines have the pid field, which is
+// noise where the PID is always the same, e.g. in containers. It is shown
+// by default. Text headers never show the PID.
+func SetShowPID(show bool) {
+	var v uint32
+	if !show {
+		v = 1
+	}
+	atomic.StoreUint32(&logging.hidePID, v)
+}
+
+// formatJSON writes the JSON encoding of a line to buf. msg is the message
+// following the (empty) header and fields are its structured fields.
+// l.mu is held.
+func (l *loggingT) formatJSON(buf *buffer, s Severity, t time.Time, file string, line int, msg []byte, fields []field) {
+	buf.WriteString(`{"severity":"`)
+	buf.WriteString(strings.ToLower(severityName[s]))
+	buf.WriteString(`","time":"`)
+	buf.WriteString(t.Format(jsonTimeFormat))
+	buf.WriteString(`","file":`)
+	buf.writeJSONString(file)
+	buf.WriteString(`,"line":`)
+	buf.Write(buf.tmp[:buf.someDigits(0, line)])
+	if atomic.LoadUint32(&l.hidePID) == 0 {
+		buf.WriteString(`,"pid":`)
+		if instanceID != "" {
+			buf.writeJSONString(instanceID)
+		} else {
+			buf.Write(buf.tmp[:buf.someDigits(0, pid)])
+		}
+	}
+	buf.WriteString(`,"msg":`)
+	buf.writeJSONString(string(bytes.TrimSuffix(msg, []byte{'\n'})))
+	if len(fields) > 0 {
+		buf.WriteString(`,"fields":`)
+		buf.writeJSONFields(fields)
+	}
+	buf.WriteString("}\n")
+}
+
+const hexDigits = "0123456789abcdef"
+
+// writeJSONString writes s as a quoted JSON string. Invalid UTF-8 is
+// replaced by U+FFFD.
+func (buf *buffer) writeJSONString(s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hexDigits[r>>4])
+			buf.WriteByte(hexDigits[r&0xf])
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,106 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Test that JSON lines decode to the logged values.
+func TestJSONFormat(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetOutputFormat(FormatText)
+	defer SetSeverityStyle(WarningSeverity, "W", "")
+	SetSeverityStyle(WarningSeverity, "W", "\x1b[33m")
+	SetOutputFormat(FormatJSON)
+
+	const msg = "a \"quoted\"\tmessage\\\x01\nspanning lines \u00e9"
+	Warning(msg)
+	line := contents(warningLog)
+	if strings.Contains(line, "\x1b") {
+		t.Errorf("color escape in JSON line %q", line)
+	}
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "}\n") {
+		t.Fatalf("not a single JSON line: %q", line)
+	}
+	var rec struct {
+		Severity string
+		Time     string
+		File     string
+		Line     int
+		Pid      int
+		Msg      string
+	}
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", line, err)
+	}
+	if rec.Severity != "warning" {
+		t.Errorf("severity is %q, want warning", rec.Severity)
+	}
+	if rec.Msg != msg {
+		t.Errorf("msg is %q, want %q", rec.Msg, msg)
+	}
+	if rec.File != "logger/glog/glog_json_test.go" || rec.Line == 0 || rec.Pid != pid {
+		t.Errorf("bad location or pid: %+v", rec)
+	}
+	// Lines of a higher severity still cascade to the lower files.
+	if !strings.HasPrefix(contents(infoLog), `{"severity":"warning"`) {
+		t.Errorf("INFO file has %q", contents(infoLog))
+	}
+}
+
+// Test that the instance ID replaces the pid in JSON lines.
+func TestJSONInstanceID(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetOutputFormat(FormatText)
+	defer SetInstanceID("")
+	SetOutputFormat(FormatJSON)
+	SetInstanceID("web-7f9c")
+	Info("test")
+	if !strings.Contains(contents(infoLog), `,"pid":"web-7f9c",`) {
+		t.Errorf("instance ID missing from %q", contents(infoLog))
+	}
+}
+
+// Test that the pid field can be omitted.
+func TestJSONShowPID(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetOutputFormat(FormatText)
+	defer SetShowPID(true)
+	SetOutputFormat(FormatJSON)
+	SetShowPID(false)
+	Info("test")
+	if strings.Contains(contents(infoLog), `"pid"`) {
+		t.Errorf("pid shown in %q", contents(infoLog))
+	}
+	var rec map[string]interface{}
+	if err := json.Unmarshal([]byte(contents(infoLog)), &rec); err != nil || rec["msg"] != "test" {
+		t.Errorf("invalid JSON %q: %v", contents(infoLog), err)
+	}
+
+	logging.newBuffers()
+	SetShowPID(true)
+	Info("test")
+	if !strings.Contains(contents(infoLog), `,"pid":`) {
+		t.Errorf("pid missing from %q", contents(infoLog))
+	}
+}
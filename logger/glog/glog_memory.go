@@ -0,0 +1,94 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// In-memory sink for tests.
+
+package glog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MemorySink keeps the lines written to it in memory. It is intended for
+// tests of packages that log, which can install it with SetSink and assert
+// on the lines logged. The zero value is ready for use.
+type MemorySink struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// NewMemorySink returns an empty MemorySink.
+func NewMemorySink() *MemorySink {
+	return new(MemorySink)
+}
+
+// Write stores the lines of p, without their trailing newlines.
+func (m *MemorySink) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		if line != "" {
+			m.lines = append(m.lines, strings.TrimSuffix(line, "\n"))
+		}
+	}
+	return len(p), nil
+}
+
+// Flush implements flushSyncWriter. It does nothing.
+func (m *MemorySink) Flush() error { return nil }
+
+// Sync implements flushSyncWriter. It does nothing.
+func (m *MemorySink) Sync() error { return nil }
+
+// Lines returns a copy of the lines stored so far, oldest first.
+func (m *MemorySink) Lines() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.lines...)
+}
+
+// Reset discards the lines stored so far.
+func (m *MemorySink) Reset() {
+	m.mu.Lock()
+	m.lines = nil
+	m.mu.Unlock()
+}
+
+// memorySinks holds the registration of the MemorySink installed for each
+// severity by SetSink. It is guarded by logging.mu.
+var memorySinks [numSeverity]*sink
+
+// SetSink makes m receive the lines of severity s, as a sink registered
+// with AddSink would, replacing the MemorySink previously set for s. A nil
+// m only removes the previous one.
+func SetSink(s Severity, m *MemorySink) error {
+	if s < debugLog || s > fatalLog {
+		return fmt.Errorf("glog: invalid severity %d", s)
+	}
+	logging.mu.Lock()
+	if old := memorySinks[s]; old != nil {
+		logging.removeSink(s, old)
+		memorySinks[s] = nil
+	}
+	if m != nil {
+		memorySinks[s] = logging.addSink(s, m)
+	}
+	logging.mu.Unlock()
+	logging.updateColors()
+	return nil
+}
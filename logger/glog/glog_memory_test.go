@@ -0,0 +1,56 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that a MemorySink receives the lines of its severity and above.
+func TestMemorySink(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetSink(WarningSeverity, nil)
+
+	m := NewMemorySink()
+	if err := SetSink(WarningSeverity, m); err != nil {
+		t.Fatal(err)
+	}
+	Info("info")
+	Warning("warning")
+	Error("error")
+	lines := m.Lines()
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "] warning") || !strings.HasSuffix(lines[1], "] error") {
+		t.Fatalf("got lines %q", lines)
+	}
+
+	// A new sink replaces the previous one.
+	m2 := NewMemorySink()
+	SetSink(WarningSeverity, m2)
+	Warning("again")
+	if len(m.Lines()) != 2 || len(m2.Lines()) != 1 {
+		t.Errorf("got lines %q and %q", m.Lines(), m2.Lines())
+	}
+	m2.Reset()
+	if len(m2.Lines()) != 0 {
+		t.Error("Reset kept lines")
+	}
+	if err := SetSink(numSeverity, m); err == nil {
+		t.Error("invalid severity accepted")
+	}
+}
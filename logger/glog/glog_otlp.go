@@ -0,0 +1,381 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Export of log lines to an OpenTelemetry (OTLP) collector.
+
+package glog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// otlpSeverityNumber maps severities to OTLP SeverityNumber values.
+var otlpSeverityNumber = [numSeverity]int{
+	debugLog:   5,
+	infoLog:    9,
+	warningLog: 13,
+	errorLog:   17,
+	fatalLog:   21,
+}
+
+// otlpRecord is a log line waiting to be exported.
+type otlpRecord struct {
+	sev    Severity
+	time   time.Time
+	file   string
+	line   int
+	body   string
+	fields []field
+}
+
+// otlpExporter batches log records and posts them to a collector using
+// the OTLP/HTTP JSON encoding. Records are handed over through a bounded
+// queue so that a slow collector never blocks logging; records that do
+// not fit are dropped and counted.
+type otlpExporter struct {
+	endpoint  string
+	service   string
+	host      string
+	headers   http.Header
+	batchSize int
+	interval  time.Duration
+	queueSize int
+	client    *http.Client
+
+	queue   chan otlpRecord
+	quit    chan struct{}
+	done    chan struct{}
+	dropped uint64 // accessed atomically
+}
+
+// OTLPOption configures the exporter installed by SetOTLP.
+type OTLPOption func(*otlpExporter)
+
+// OTLPBatchSize sets the maximum number of records sent in one request.
+func OTLPBatchSize(n int) OTLPOption {
+	return func(e *otlpExporter) { e.batchSize = n }
+}
+
+// OTLPFlushInterval sets how long records may wait before a partial
+// batch is sent.
+func OTLPFlushInterval(d time.Duration) OTLPOption {
+	return func(e *otlpExporter) { e.interval = d }
+}
+
+// OTLPQueueSize sets the number of records buffered before new ones are dropped.
+func OTLPQueueSize(n int) OTLPOption {
+	return func(e *otlpExporter) { e.queueSize = n }
+}
+
+// OTLPHeader adds an HTTP header, e.g. for authentication, to every request.
+func OTLPHeader(key, value string) OTLPOption {
+	return func(e *otlpExporter) { e.headers.Add(key, value) }
+}
+
+// OTLPServiceName sets the service.name resource attribute. It defaults
+// to the program name.
+func OTLPServiceName(name string) OTLPOption {
+	return func(e *otlpExporter) { e.service = name }
+}
+
+// SetOTLP starts exporting every log line to the OpenTelemetry collector
+// listening at endpoint, the full URL of its OTLP/HTTP logs receiver
+// (e.g. "http://localhost:4318/v1/logs"). Any previously configured
+// exporter is stopped after sending its pending records. An empty endpoint
+// only stops the current exporter.
+func SetOTLP(endpoint string, opts ...OTLPOption) error {
+	var e *otlpExporter
+	if endpoint != "" {
+		logging.mu.Lock()
+		service, hostName := program, host
+		logging.mu.Unlock()
+		e = &otlpExporter{
+			endpoint:  endpoint,
+			service:   service,
+			host:      hostName,
+			headers:   make(http.Header),
+			batchSize: 512,
+			interval:  time.Second,
+			queueSize: 8192,
+			client:    &http.Client{Timeout: 10 * time.Second},
+			quit:      make(chan struct{}),
+			done:      make(chan struct{}),
+		}
+		for _, opt := range opts {
+			opt(e)
+		}
+		if e.batchSize <= 0 || e.interval <= 0 || e.queueSize <= 0 {
+			return errors.New("glog: OTLP batch size, flush interval and queue size must be positive")
+		}
+		e.queue = make(chan otlpRecord, e.queueSize)
+		go e.loop()
+	}
+	logging.mu.Lock()
+	old := logging.otlp
+	logging.otlp = e
+	logging.updateReach()
+	logging.mu.Unlock()
+
+	if old != nil {
+		old.stop()
+	}
+	return nil
+}
+
+// OTLPDropped returns the number of records the current exporter dropped
+// because its queue was full or the collector could not be reached.
+func OTLPDropped() uint64 {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if logging.otlp == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&logging.otlp.dropped)
+}
+
+// enqueue hands a record to the export loop without blocking.
+// l.mu is held.
+func (e *otlpExporter) enqueue(s Severity, t time.Time, file string, line int, msg []byte, fields []field) {
+	rec := otlpRecord{sev: s, time: t, file: file, line: line, body: string(bytes.TrimSuffix(msg, []byte{'\n'})), fields: fields}
+	select {
+	case e.queue <- rec:
+	default:
+		atomic.AddUint64(&e.dropped, 1)
+	}
+}
+
+// stop sends the records still queued and terminates the export loop.
+func (e *otlpExporter) stop() {
+	close(e.quit)
+	<-e.done
+}
+
+func (e *otlpExporter) loop() {
+	defer close(e.done)
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]otlpRecord, 0, e.batchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil {
+			atomic.AddUint64(&e.dropped, uint64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case rec := <-e.queue:
+			if batch = append(batch, rec); len(batch) >= e.batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-e.quit:
+			for {
+				select {
+				case rec := <-e.queue:
+					if batch = append(batch, rec); len(batch) >= e.batchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+// The types below mirror the JSON encoding of the OTLP logs protocol.
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 values are encoded as strings
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string         `json:"timeUnixNano"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText"`
+	Body           otlpAnyValue   `json:"body"`
+	Attributes     []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpKeyValue {
+	s := strconv.FormatInt(value, 10)
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &s}}
+}
+
+// otlpUint returns an int attribute, or a string one for values beyond
+// the range of the int64 values of OTLP.
+func otlpUint(key string, value uint64) otlpKeyValue {
+	if value > math.MaxInt64 {
+		return otlpString(key, strconv.FormatUint(value, 10))
+	}
+	return otlpInt(key, int64(value))
+}
+
+// otlpDouble returns a double attribute. JSON has no NaN or infinities,
+// so those are sent as strings.
+func otlpDouble(key string, value float64) otlpKeyValue {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return otlpString(key, fmt.Sprint(value))
+	}
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{DoubleValue: &value}}
+}
+
+// otlpField converts a structured field to an attribute. Values without
+// an OTLP counterpart are sent as strings.
+func otlpField(fld field) otlpKeyValue {
+	switch v := fld.value.(type) {
+	case string:
+		return otlpString(fld.key, v)
+	case bool:
+		return otlpKeyValue{Key: fld.key, Value: otlpAnyValue{BoolValue: &v}}
+	case int:
+		return otlpInt(fld.key, int64(v))
+	case int8:
+		return otlpInt(fld.key, int64(v))
+	case int16:
+		return otlpInt(fld.key, int64(v))
+	case int32:
+		return otlpInt(fld.key, int64(v))
+	case int64:
+		return otlpInt(fld.key, v)
+	case uint8:
+		return otlpInt(fld.key, int64(v))
+	case uint16:
+		return otlpInt(fld.key, int64(v))
+	case uint32:
+		return otlpInt(fld.key, int64(v))
+	case uint:
+		return otlpUint(fld.key, uint64(v))
+	case uint64:
+		return otlpUint(fld.key, v)
+	case float32:
+		return otlpDouble(fld.key, float64(v))
+	case float64:
+		return otlpDouble(fld.key, v)
+	}
+	if s, ok := canonicalFieldValue(fld.value); ok {
+		return otlpString(fld.key, s)
+	}
+	return otlpString(fld.key, fmt.Sprint(fld.value))
+}
+
+// encode converts a batch of records to an OTLP export request.
+func (e *otlpExporter) encode(batch []otlpRecord) otlpRequest {
+	scope := otlpScopeLogs{Scope: otlpScope{Name: "glog"}, LogRecords: make([]otlpLogRecord, len(batch))}
+	for i, rec := range batch {
+		body := rec.body
+		scope.LogRecords[i] = otlpLogRecord{
+			TimeUnixNano:   strconv.FormatInt(rec.time.UnixNano(), 10),
+			SeverityNumber: otlpSeverityNumber[rec.sev],
+			SeverityText:   severityName[rec.sev],
+			Body:           otlpAnyValue{StringValue: &body},
+			Attributes: []otlpKeyValue{
+				otlpString("code.filepath", rec.file),
+				otlpInt("code.lineno", int64(rec.line)),
+			},
+		}
+		for _, fld := range rec.fields {
+			scope.LogRecords[i].Attributes = append(scope.LogRecords[i].Attributes, otlpField(fld))
+		}
+	}
+	// Report the same process identifier as the log file names.
+	logging.mu.Lock()
+	id := instanceID
+	logging.mu.Unlock()
+	procID := otlpInt("process.pid", int64(pid))
+	if id != "" {
+		procID = otlpString("process.pid", id)
+	}
+	res := otlpResourceLogs{ScopeLogs: []otlpScopeLogs{scope}}
+	res.Resource.Attributes = []otlpKeyValue{
+		otlpString("service.name", e.service),
+		otlpString("host.name", e.host),
+		procID,
+	}
+	return otlpRequest{ResourceLogs: []otlpResourceLogs{res}}
+}
+
+// send posts a batch of records to the collector.
+func (e *otlpExporter) send(batch []otlpRecord) error {
+	body, err := json.Marshal(e.encode(batch))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range e.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("glog: OTLP collector returned %s", resp.Status)
+	}
+	return nil
+}
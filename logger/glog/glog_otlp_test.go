@@ -0,0 +1,151 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test that log lines are exported to an OTLP/HTTP collector.
+func TestOTLPExport(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records []otlpLogRecord
+		auth    string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		mu.Lock()
+		auth = r.Header.Get("Authorization")
+		for _, res := range req.ResourceLogs {
+			for _, scope := range res.ScopeLogs {
+				records = append(records, scope.LogRecords...)
+			}
+		}
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	if err := SetOTLP(srv.URL, OTLPFlushInterval(10*time.Millisecond), OTLPHeader("Authorization", "secret")); err != nil {
+		t.Fatal(err)
+	}
+	Info("first")
+	Warning("second")
+	WithFields(map[string]interface{}{"peer": "abc", "n": 3, "ok": true, "u": uint64(7)}).Info("third")
+	SetOTLP("") // flushes the pending batch
+
+	mu.Lock()
+	defer mu.Unlock()
+	if auth != "secret" {
+		t.Errorf("Authorization header not sent, got %q", auth)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+	for i, want := range []struct {
+		body string
+		num  int
+		text string
+	}{
+		{"first", 9, "INFO"},
+		{"second", 13, "WARNING"},
+	} {
+		rec := records[i]
+		if *rec.Body.StringValue != want.body {
+			t.Errorf("record %d: body %q, want %q", i, *rec.Body.StringValue, want.body)
+		}
+		if rec.SeverityNumber != want.num || rec.SeverityText != want.text {
+			t.Errorf("record %d: severity %d/%s, want %d/%s", i, rec.SeverityNumber, rec.SeverityText, want.num, want.text)
+		}
+		if len(rec.Attributes) != 2 || *rec.Attributes[0].Value.StringValue != "logger/glog/glog_otlp_test.go" {
+			t.Errorf("record %d: bad attributes %+v", i, rec.Attributes)
+		}
+	}
+	// Fields follow the code location, sorted by key.
+	attrs := records[2].Attributes
+	if len(attrs) != 6 {
+		t.Fatalf("fields not exported as attributes: %+v", attrs)
+	}
+	if attrs[2].Key != "n" || attrs[2].Value.IntValue == nil || *attrs[2].Value.IntValue != "3" {
+		t.Errorf("bad int attribute %+v", attrs[2])
+	}
+	if attrs[3].Key != "ok" || attrs[3].Value.BoolValue == nil || !*attrs[3].Value.BoolValue {
+		t.Errorf("bad bool attribute %+v", attrs[3])
+	}
+	if attrs[4].Key != "peer" || attrs[4].Value.StringValue == nil || *attrs[4].Value.StringValue != "abc" {
+		t.Errorf("bad string attribute %+v", attrs[4])
+	}
+	if attrs[5].Key != "u" || attrs[5].Value.IntValue == nil || *attrs[5].Value.IntValue != "7" {
+		t.Errorf("bad unsigned attribute %+v", attrs[5])
+	}
+}
+
+// Test that process.pid reports the instance ID when one is set.
+func TestOTLPInstanceID(t *testing.T) {
+	e := &otlpExporter{service: "geth", host: "node"}
+	SetInstanceID("abc-1")
+	attrs := e.encode(nil).ResourceLogs[0].Resource.Attributes
+	SetInstanceID("")
+	if attrs[2].Key != "process.pid" || attrs[2].Value.StringValue == nil || *attrs[2].Value.StringValue != "abc-1" {
+		t.Errorf("instance ID not exported, got %+v", attrs[2])
+	}
+	attrs = e.encode(nil).ResourceLogs[0].Resource.Attributes
+	if attrs[2].Value.IntValue == nil || *attrs[2].Value.IntValue != strconv.Itoa(pid) {
+		t.Errorf("pid not exported, got %+v", attrs[2])
+	}
+}
+
+// Test that records are dropped instead of blocking when the queue is full.
+func TestOTLPQueueFull(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer srv.Close()
+
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	if err := SetOTLP(srv.URL, OTLPBatchSize(1), OTLPQueueSize(1)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		Info("storm")
+	}
+	if dropped := OTLPDropped(); dropped == 0 {
+		t.Error("no records dropped")
+	}
+	close(block)
+	SetOTLP("")
+}
+
+// Test that invalid options are rejected.
+func TestOTLPInvalidOptions(t *testing.T) {
+	if err := SetOTLP("http://localhost:4318/v1/logs", OTLPQueueSize(0)); err == nil {
+		t.Error("zero queue size accepted")
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// In-memory retention of recent log lines.
+
+package glog
+
+import "sync"
+
+// ringBuffer retains the most recent formatted lines of each severity.
+// Like the log files, the lines of a severity include those of all higher
+// severities. It has its own lock so that readers never hold logging.mu.
+type ringBuffer struct {
+	mu    sync.Mutex
+	lines [numSeverity][]string
+	next  [numSeverity]int // index of the slot written next
+	count [numSeverity]int // number of slots in use
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	r := new(ringBuffer)
+	for s := range r.lines {
+		r.lines[s] = make([]string, capacity)
+	}
+	return r
+}
+
+// add stores a line of severity s, overwriting the oldest one if full.
+func (r *ringBuffer) add(s Severity, line string) {
+	r.mu.Lock()
+	for ; s >= debugLog; s-- {
+		r.lines[s][r.next[s]] = line
+		r.next[s] = (r.next[s] + 1) % len(r.lines[s])
+		if r.count[s] < len(r.lines[s]) {
+			r.count[s]++
+		}
+	}
+	r.mu.Unlock()
+}
+
+// recent returns up to n of the newest lines of severity s, oldest first.
+func (r *ringBuffer) recent(s Severity, n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n > r.count[s] {
+		n = r.count[s]
+	}
+	size := len(r.lines[s])
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = r.lines[s][(r.next[s]-n+i+size)%size]
+	}
+	return lines
+}
+
+// EnableRingBuffer makes the logger retain, in memory, the last capacity
+// lines of each severity for retrieval with RecentLines. Enabling it again
+// discards the retained lines. A capacity of zero or less disables it.
+func EnableRingBuffer(capacity int) {
+	var r *ringBuffer
+	if capacity > 0 {
+		r = newRingBuffer(capacity)
+	}
+	logging.ring.Store(r)
+}
+
+// RecentLines returns up to n of the most recently logged lines of severity
+// s or higher, oldest first. It returns nil if the ring buffer is disabled.
+func RecentLines(s Severity, n int) []string {
+	r, _ := logging.ring.Load().(*ringBuffer)
+	if r == nil || s < debugLog || s > fatalLog || n <= 0 {
+		return nil
+	}
+	return r.recent(s, n)
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Test that the ring buffer keeps only the newest lines.
+func TestRingBuffer(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer EnableRingBuffer(0)
+
+	if lines := RecentLines(infoLog, 10); lines != nil {
+		t.Fatalf("disabled ring buffer returned %q", lines)
+	}
+	EnableRingBuffer(3)
+	for i := 0; i < 5; i++ {
+		Infof("line %d", i)
+	}
+	Warning("warn")
+
+	lines := RecentLines(infoLog, 10)
+	if len(lines) != 3 {
+		t.Fatalf("got %d info lines, want 3: %q", len(lines), lines)
+	}
+	for i, want := range []string{"line 3", "line 4", "warn"} {
+		if !strings.HasSuffix(lines[i], "] "+want+"\n") {
+			t.Errorf("line %d is %q, want %q", i, lines[i], want)
+		}
+	}
+	if lines := RecentLines(infoLog, 1); len(lines) != 1 || !strings.HasSuffix(lines[0], "] warn\n") {
+		t.Errorf("newest info line is %q, want warn", lines)
+	}
+	if lines := RecentLines(warningLog, 10); len(lines) != 1 || lines[0][0] != 'W' {
+		t.Errorf("warning lines are %q, want one warning", lines)
+	}
+	if lines := RecentLines(errorLog, 10); len(lines) != 0 {
+		t.Errorf("error lines are %q, want none", lines)
+	}
+}
+
+func BenchmarkRingBuffer(b *testing.B) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer EnableRingBuffer(0)
+	EnableRingBuffer(4096)
+	for i := 0; i < b.N; i++ {
+		Info(fmt.Sprint("line ", i))
+	}
+}
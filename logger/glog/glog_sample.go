@@ -0,0 +1,208 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Rate limiting of repetitive log lines.
+
+package glog
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxSampleKeys bounds the number of keys whose rate is tracked.
+const maxSampleKeys = 1024
+
+// sampleState tracks the lines logged under a key in the current window.
+type sampleState struct {
+	start      time.Time // start of the current window
+	count      int       // lines allowed in the current window
+	suppressed int       // lines dropped and not yet reported
+
+	// Severity and location of the first line dropped since the last
+	// report, to which the report is attributed.
+	sev  Severity
+	file string
+	line int
+}
+
+// sampling holds the state of all sampled keys.
+var sampling struct {
+	sync.Mutex
+	keys map[string]*sampleState
+}
+
+// Sampler logs at most max lines per window for a key, dropping the rest.
+// The number of dropped lines is reported before the first line logged in
+// the next window, and by every Flush, including those of the periodic
+// flushing, so that a storm that stops is reported too. Sampler values are safe for
+// concurrent use; all Samplers with the same key share their count.
+type Sampler struct {
+	key    string
+	max    int
+	window time.Duration
+}
+
+// Sampled returns a Sampler that lets at most max lines logged under key
+// through per window, e.g. to survive storms of identical warnings during
+// a chain reorganisation:
+//
+//	glog.Sampled("reorg-drop", 10, time.Minute).Warningf("dropped tx %x", hash)
+//
+// At most maxSampleKeys keys are tracked; the state of the oldest is
+// discarded when more are used.
+func Sampled(key string, max int, window time.Duration) Sampler {
+	return Sampler{key, max, window}
+}
+
+// allow reports whether a line of severity s may be logged now, and the
+// number of unreported lines dropped in the previous window if this is the
+// first line of a new one.
+func (sm Sampler) allow(s Severity) (ok bool, suppressed int) {
+	now := logging.now()
+	sampling.Lock()
+	defer sampling.Unlock()
+	if sampling.keys == nil {
+		sampling.keys = make(map[string]*sampleState)
+	}
+	st := sampling.keys[sm.key]
+	if st == nil {
+		if len(sampling.keys) >= maxSampleKeys {
+			evictSampleKey()
+		}
+		st = &sampleState{start: now}
+		sampling.keys[sm.key] = st
+	} else if now.Sub(st.start) >= sm.window {
+		suppressed = st.suppressed
+		*st = sampleState{start: now}
+	}
+	if st.count >= sm.max {
+		if st.suppressed == 0 {
+			// Skip allow and the Sampler method.
+			st.sev, st.file, st.line = s, "???", 1
+			if _, file, line, ok := runtime.Caller(2); ok {
+				st.file, st.line = headerFile(file), line
+			}
+		}
+		st.suppressed++
+		return false, 0
+	}
+	st.count++
+	return true, suppressed
+}
+
+// evictSampleKey discards the state of the key whose window started first.
+// sampling is locked.
+func evictSampleKey() {
+	var (
+		oldest string
+		start  time.Time
+		found  bool
+	)
+	for key, st := range sampling.keys {
+		if !found || st.start.Before(start) {
+			oldest, start, found = key, st.start, true
+		}
+	}
+	delete(sampling.keys, oldest)
+}
+
+// flushSampled reports the lines dropped by Samplers since the last report.
+func flushSampled() {
+	type report struct {
+		key       string
+		sev       Severity
+		file      string
+		line, num int
+	}
+	var reports []report
+	sampling.Lock()
+	for key, st := range sampling.keys {
+		if st.suppressed > 0 {
+			reports = append(reports, report{key, st.sev, st.file, st.line, st.suppressed})
+			st.suppressed = 0
+		}
+	}
+	sampling.Unlock()
+	sort.Slice(reports, func(i, j int) bool { return reports[i].key < reports[j].key })
+	for _, r := range reports {
+		logging.printWithFileLine(r.sev, r.file, r.line, false, r.num, " messages suppressed for ", r.key)
+	}
+}
+
+// Info logs to the INFO and DEBUG logs, unless the rate of key is exceeded.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func (sm Sampler) Info(args ...interface{}) {
+	if ok, n := sm.allow(infoLog); ok {
+		sm.printSuppressed(infoLog, n)
+		logging.printDepth(infoLog, 0, args...)
+	}
+}
+
+// Infof logs to the INFO and DEBUG logs, unless the rate of key is exceeded.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func (sm Sampler) Infof(format string, args ...interface{}) {
+	if ok, n := sm.allow(infoLog); ok {
+		sm.printSuppressed(infoLog, n)
+		logging.printfmt(infoLog, format, args...)
+	}
+}
+
+// Warning logs to the WARNING, INFO, and DEBUG logs, unless the rate of key is exceeded.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func (sm Sampler) Warning(args ...interface{}) {
+	if ok, n := sm.allow(warningLog); ok {
+		sm.printSuppressed(warningLog, n)
+		logging.printDepth(warningLog, 0, args...)
+	}
+}
+
+// Warningf logs to the WARNING, INFO, and DEBUG logs, unless the rate of key is exceeded.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func (sm Sampler) Warningf(format string, args ...interface{}) {
+	if ok, n := sm.allow(warningLog); ok {
+		sm.printSuppressed(warningLog, n)
+		logging.printfmt(warningLog, format, args...)
+	}
+}
+
+// Error logs to the ERROR, WARNING, INFO, and DEBUG logs, unless the rate of key is exceeded.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func (sm Sampler) Error(args ...interface{}) {
+	if ok, n := sm.allow(errorLog); ok {
+		sm.printSuppressed(errorLog, n)
+		logging.printDepth(errorLog, 0, args...)
+	}
+}
+
+// Errorf logs to the ERROR, WARNING, INFO, and DEBUG logs, unless the rate of key is exceeded.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func (sm Sampler) Errorf(format string, args ...interface{}) {
+	if ok, n := sm.allow(errorLog); ok {
+		sm.printSuppressed(errorLog, n)
+		logging.printfmt(errorLog, format, args...)
+	}
+}
+
+// printSuppressed reports n dropped lines, if any. The line is attributed
+// to the caller of the Sampler method.
+func (sm Sampler) printSuppressed(s Severity, n int) {
+	if n > 0 {
+		logging.printDepth(s, 1, n, " messages suppressed for ", sm.key)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that sampled lines are limited per window and drops are reported.
+func TestSampled(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	clock := &fakeClock{now: time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)}
+	defer SetClock(nil)
+	SetClock(clock)
+
+	for i := 0; i < 1000; i++ {
+		Sampled("storm", 5, time.Second).Warningf("storm %d", i)
+	}
+	if n := strings.Count(contents(warningLog), "\n"); n != 5 {
+		t.Fatalf("got %d lines, want 5:\n%s", n, contents(warningLog))
+	}
+	if !contains(warningLog, "storm 4\n", t) || contains(warningLog, "storm 5\n", t) {
+		t.Errorf("wrong lines let through:\n%s", contents(warningLog))
+	}
+
+	// Other keys are counted separately.
+	Sampled("other", 5, time.Second).Info("other")
+	if !contains(infoLog, "] other\n", t) {
+		t.Error("line of another key dropped")
+	}
+
+	// The next window starts with a summary of the drops.
+	clock.Advance(time.Second)
+	logging.newBuffers()
+	Sampled("storm", 5, time.Second).Warning("after")
+	lines := strings.Split(strings.TrimSuffix(contents(warningLog), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "] 995 messages suppressed for storm") || !strings.HasSuffix(lines[1], "] after") {
+		t.Errorf("unexpected lines after window:\n%s", contents(warningLog))
+	}
+	if !strings.Contains(lines[0], " logger/glog/glog_sample_test.go:") {
+		t.Errorf("summary attributed to the wrong caller: %s", lines[0])
+	}
+}
+
+// Test that Flush reports the drops of a storm that has stopped.
+func TestSampledFlush(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	clock := &fakeClock{now: time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)}
+	defer SetClock(nil)
+	SetClock(clock)
+
+	for i := 0; i < 10; i++ {
+		Sampled("storm", 2, time.Minute).Error("storm")
+	}
+	Flush()
+	lines := strings.Split(strings.TrimSuffix(contents(errorLog), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[2], "] 8 messages suppressed for storm") {
+		t.Fatalf("unexpected lines after flush:\n%s", contents(errorLog))
+	}
+	if !strings.HasPrefix(lines[2], "E") || !strings.Contains(lines[2], " logger/glog/glog_sample_test.go:") {
+		t.Errorf("summary has the wrong severity or caller: %s", lines[2])
+	}
+
+	// Drops are reported once.
+	logging.newBuffers()
+	Flush()
+	clock.Advance(time.Minute)
+	Sampled("storm", 2, time.Minute).Error("after")
+	if contains(errorLog, "suppressed", t) {
+		t.Errorf("drops reported twice:\n%s", contents(errorLog))
+	}
+}
+
+// Test that the number of tracked keys is bounded.
+func TestSampledKeysBounded(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	clock := &fakeClock{now: time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)}
+	defer SetClock(nil)
+	SetClock(clock)
+
+	// Window starts in the future, e.g. after the clock went back, do not
+	// prevent eviction.
+	for i := 0; i < maxSampleKeys; i++ {
+		Sampled(strconv.Itoa(i), 1, time.Minute).Info("x")
+	}
+	clock.Advance(-time.Hour)
+	for i := maxSampleKeys; i < 2*maxSampleKeys; i++ {
+		Sampled(strconv.Itoa(i), 1, time.Minute).Info("x")
+	}
+	sampling.Lock()
+	defer sampling.Unlock()
+	if len(sampling.keys) > maxSampleKeys {
+		t.Errorf("%d keys tracked, want at most %d", len(sampling.keys), maxSampleKeys)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows,!plan9
+
+package glog
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var rotationSignalOnce sync.Once
+
+// HandleRotationSignal makes the process start new log files whenever it
+// receives SIGHUP, as expected by tools such as logrotate. Calling it more
+// than once has no further effect. On platforms without SIGHUP it does
+// nothing.
+func HandleRotationSignal() {
+	rotationSignalOnce.Do(func() {
+		sigc := make(chan os.Signal, 1)
+		signal.Notify(sigc, syscall.SIGHUP)
+		go func() {
+			for range sigc {
+				if err := RotateAll(); err != nil {
+					fmt.Fprintf(os.Stderr, "log: cannot rotate on SIGHUP: %v\n", err)
+				}
+			}
+		}()
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows,!plan9
+
+package glog
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Test that SIGHUP starts new log files.
+func TestRotationSignal(t *testing.T) {
+	setFlags()
+	Info("x") // Be sure we have a file.
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	name := func() string {
+		logging.mu.Lock()
+		defer logging.mu.Unlock()
+		return info.file.Name()
+	}
+	fname0 := name()
+
+	HandleRotationSignal()
+	HandleRotationSignal() // must not install a second handler
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); name() == fname0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("info.f.Name did not change: %v", fname0)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build go1.21
+
+package glog
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+)
+
+// SlogHandlerOptions configures the handler returned by NewSlogHandler.
+type SlogHandlerOptions struct {
+	// Level is the minimum level of the records logged. It defaults to
+	// slog.LevelInfo.
+	Level slog.Leveler
+}
+
+// slogHandler is a slog.Handler writing records to the glog logs.
+type slogHandler struct {
+	level  slog.Leveler
+	group  string  // prefix of the keys of attributes added later
+	fields []field // attributes added by WithAttrs
+}
+
+// NewSlogHandler returns a slog.Handler that writes records to the glog
+// logs, so that libraries using log/slog share glog's files, rotation and
+// sinks. Levels below slog.LevelInfo map to DEBUG, below slog.LevelWarn to
+// INFO, below slog.LevelError to WARNING and all others to ERROR.
+// Attributes become fields as with WithFields; the keys of grouped
+// attributes are joined with dots. The source line of the record, if
+// known, is used for the header. opts may be nil.
+func NewSlogHandler(opts *SlogHandlerOptions) slog.Handler {
+	h := &slogHandler{level: slog.LevelInfo}
+	if opts != nil && opts.Level != nil {
+		h.level = opts.Level
+	}
+	return h
+}
+
+// slogSeverity maps a slog level to a severity.
+func slogSeverity(level slog.Level) Severity {
+	switch {
+	case level < slog.LevelInfo:
+		return debugLog
+	case level < slog.LevelWarn:
+		return infoLog
+	case level < slog.LevelError:
+		return warningLog
+	default:
+		return errorLog
+	}
+}
+
+// Enabled implements slog.Handler.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle implements slog.Handler.
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	fields := make([]field, len(h.fields), len(h.fields)+r.NumAttrs())
+	copy(fields, h.fields)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendSlogAttr(fields, h.group, a)
+		return true
+	})
+	file, line := "???", 1
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		if frame.File != "" {
+			file, line = headerFile(frame.File), frame.Line
+		}
+	}
+	logging.printFieldsWithFileLine(slogSeverity(r.Level), file, line, fields, r.Message)
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.fields = make([]field, len(h.fields), len(h.fields)+len(attrs))
+	copy(h2.fields, h.fields)
+	for _, a := range attrs {
+		h2.fields = appendSlogAttr(h2.fields, h.group, a)
+	}
+	return &h2
+}
+
+// WithGroup implements slog.Handler.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.group = h.group + name + "."
+	return &h2
+}
+
+// appendSlogAttr appends a as fields, flattening groups, with keys
+// prefixed by prefix.
+func appendSlogAttr(fields []field, prefix string, a slog.Attr) []field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendSlogAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, field{prefix + a.Key, a.Value.Any()})
+}
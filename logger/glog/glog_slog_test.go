@@ -0,0 +1,66 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build go1.21
+
+package glog
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"testing"
+)
+
+// Test that slog records are written to the glog logs.
+func TestSlogHandler(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	logger := slog.New(NewSlogHandler(nil))
+	logger.Debug("hidden")
+	if contents(debugLog) != "" {
+		t.Errorf("debug record logged below the default level: %q", contents(debugLog))
+	}
+
+	sub := logger.With("a", 1).WithGroup("g").With("b", "x y")
+	_, _, line, _ := runtime.Caller(0)
+	sub.Info("hello", "c", true, slog.Group("h", "d", 2))
+	want := fmt.Sprintf("glog_slog_test.go:%d] hello a=1 g.b=\"x y\" g.c=true g.h.d=2", line+1)
+	if !contains(infoLog, want, t) {
+		t.Errorf("INFO log is %q, want it to contain %q", contents(infoLog), want)
+	}
+	if contains(warningLog, "hello", t) {
+		t.Error("INFO record written to the WARNING log")
+	}
+
+	logger.Warn("careful")
+	logger.Error("failed", "err", "boom")
+	if !contains(warningLog, "careful", t) || contains(errorLog, "careful", t) {
+		t.Error("WARN record not mapped to WARNING")
+	}
+	if !contains(errorLog, "failed err=boom", t) {
+		t.Errorf("ERROR log is %q", contents(errorLog))
+	}
+
+	defer SetFileThreshold(InfoSeverity)
+	SetFileThreshold(DebugSeverity)
+	debug := slog.New(NewSlogHandler(&SlogHandlerOptions{Level: slog.LevelDebug}))
+	debug.Debug("shown")
+	if !contains(debugLog, "shown", t) || contains(infoLog, "shown", t) {
+		t.Error("DEBUG record not mapped to DEBUG")
+	}
+}
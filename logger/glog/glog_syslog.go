@@ -0,0 +1,73 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows,!plan9
+
+package glog
+
+import "log/syslog"
+
+// syslogPriority maps severities to syslog priorities.
+var syslogPriority = [numSeverity]syslog.Priority{
+	debugLog:   syslog.LOG_DEBUG,
+	infoLog:    syslog.LOG_INFO,
+	warningLog: syslog.LOG_WARNING,
+	errorLog:   syslog.LOG_ERR,
+	fatalLog:   syslog.LOG_CRIT,
+}
+
+// syslogWriter is a syslogger writing to a syslog connection.
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func (sw syslogWriter) log(s Severity, msg string) error {
+	switch syslogPriority[s] {
+	case syslog.LOG_DEBUG:
+		return sw.w.Debug(msg)
+	case syslog.LOG_INFO:
+		return sw.w.Info(msg)
+	case syslog.LOG_WARNING:
+		return sw.w.Warning(msg)
+	case syslog.LOG_ERR:
+		return sw.w.Err(msg)
+	default:
+		return sw.w.Crit(msg)
+	}
+}
+
+// SetSyslog sends every log line, in addition to the other destinations,
+// to the syslog daemon listening at addr on network, tagged tag. An empty
+// network and addr connect to the local syslog socket; see syslog.Dial.
+// Each line is sent with the priority of its severity. If the daemon
+// cannot be reached, lines are also written to standard error instead
+// and the dial error is returned, until a later call succeeds.
+func SetSyslog(network, addr, tag string) error {
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if old, ok := logging.syslog.(syslogWriter); ok {
+		old.w.Close() // ignore error
+	}
+	defer logging.updateReach()
+	logging.setSyslogFallback(err != nil)
+	if err != nil {
+		logging.syslog = nil
+		return err
+	}
+	logging.syslog = syslogWriter{w}
+	return nil
+}
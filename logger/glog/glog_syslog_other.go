@@ -0,0 +1,31 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build windows plan9
+
+package glog
+
+import "errors"
+
+// SetSyslog is not supported on this platform, which has no log/syslog.
+// Lines are written to standard error as well instead.
+func SetSyslog(network, addr, tag string) error {
+	logging.mu.Lock()
+	logging.setSyslogFallback(true)
+	logging.updateReach()
+	logging.mu.Unlock()
+	return errors.New("glog: syslog is not supported on this platform")
+}
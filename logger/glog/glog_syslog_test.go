@@ -0,0 +1,141 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build !windows,!plan9
+
+package glog
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that lines reach syslog with the priority of their severity.
+func TestSyslog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skip("cannot listen on a unix socket:", err)
+	}
+	defer conn.Close()
+
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetSeverityStyle(WarningSeverity, "W", "")
+	SetSeverityStyle(WarningSeverity, "W", "\x1b[33m")
+	if err := SetSyslog("unixgram", addr, "geth"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		logging.mu.Lock()
+		logging.syslog.(syslogWriter).w.Close()
+		logging.syslog = nil
+		logging.updateReach()
+		logging.mu.Unlock()
+	}()
+
+	read := func() string {
+		buf := make([]byte, 1024)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+	Warning("disk almost full")
+	msg := read()
+	// LOG_USER|LOG_WARNING is 8+4.
+	if !strings.HasPrefix(msg, "<12>") {
+		t.Errorf("wrong priority in %q", msg)
+	}
+	if !strings.Contains(msg, "geth[") || !strings.Contains(msg, " logger/glog/glog_syslog_test.go:") {
+		t.Errorf("unexpected message %q", msg)
+	}
+	if !strings.HasSuffix(msg, "] disk almost full\n") || strings.Contains(msg, "\x1b") {
+		t.Errorf("header not stripped from %q", msg)
+	}
+	Error("broken")
+	// LOG_USER|LOG_ERR is 8+3.
+	if msg := read(); !strings.HasPrefix(msg, "<11>") {
+		t.Errorf("wrong priority in %q", msg)
+	}
+}
+
+// Test that lines go to standard error if syslog cannot be reached.
+func TestSyslogFallback(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous io.Writer) { stderr = previous }(stderr)
+	rec := new(stderrRecorder)
+	stderr = rec
+	defer SetAlsoToStderr(false)
+
+	if err := SetSyslog("unixgram", "/nonexistent/log.sock", "geth"); err == nil {
+		t.Fatal("no error for unreachable syslog")
+	}
+	Info("fallback")
+	if len(rec.chunks) != 1 || !strings.Contains(rec.chunks[0], "fallback") {
+		t.Errorf("stderr got %q", rec.chunks)
+	}
+
+	// Reaching syslog later ends the fallback.
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenPacket("unixgram", addr)
+	if err != nil {
+		t.Skip("cannot listen on a unix socket:", err)
+	}
+	defer conn.Close()
+	if err := SetSyslog("unixgram", addr, "geth"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		logging.mu.Lock()
+		logging.syslog.(syslogWriter).w.Close()
+		logging.syslog = nil
+		logging.updateReach()
+		logging.mu.Unlock()
+	}()
+	Info("recovered")
+	if len(rec.chunks) != 1 {
+		t.Errorf("stderr still used after syslog recovered: %q", rec.chunks)
+	}
+
+	// A fallback does not undo an explicit SetAlsoToStderr.
+	SetAlsoToStderr(true)
+	SetSyslog("unixgram", "/nonexistent/log.sock", "geth")
+	SetSyslog("unixgram", addr, "geth")
+	Info("explicit")
+	if len(rec.chunks) != 2 || !strings.Contains(rec.chunks[1], "explicit") {
+		t.Errorf("stderr got %q", rec.chunks)
+	}
+}
@@ -18,12 +18,19 @@ package glog
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	stdLog "log"
+	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -67,22 +74,30 @@ func (l *loggingT) swap(writers [numSeverity]flushSyncWriter) (old [numSeverity]
 
 // newBuffers sets the log writers to all new byte buffers and returns the old array.
 func (l *loggingT) newBuffers() [numSeverity]flushSyncWriter {
-	return l.swap([numSeverity]flushSyncWriter{new(flushBuffer), new(flushBuffer), new(flushBuffer), new(flushBuffer)})
+	return l.swap([numSeverity]flushSyncWriter{new(flushBuffer), new(flushBuffer), new(flushBuffer), new(flushBuffer), new(flushBuffer)})
 }
 
 // contents returns the specified log value as a string.
-func contents(s severity) string {
+func contents(s Severity) string {
 	return logging.file[s].(*flushBuffer).String()
 }
 
 // contains reports whether the string is contained in the log.
-func contains(s severity, str string, t *testing.T) bool {
+func contains(s Severity, str string, t *testing.T) bool {
 	return strings.Contains(contents(s), str)
 }
 
 // setFlags configures the logging flags how the test expects them.
 func setFlags() {
-	logging.toStderr = false
+	SetToStderr(false)
+	resetSampling()
+}
+
+// resetSampling discards the state of all Samplers.
+func resetSampling() {
+	sampling.Lock()
+	sampling.keys = nil
+	sampling.Unlock()
 }
 
 // Test that Info works as advertised.
@@ -98,6 +113,28 @@ func TestInfo(t *testing.T) {
 	}
 }
 
+// Test that Debug lines go to the DEBUG log only.
+func TestDebug(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetFileThreshold(InfoSeverity)
+	SetFileThreshold(DebugSeverity)
+	Debugf("test %d", 1)
+	if !contains(debugLog, "D", t) {
+		t.Errorf("Debug has wrong character: %q", contents(debugLog))
+	}
+	if !contains(debugLog, "test 1", t) {
+		t.Error("Debug failed")
+	}
+	if contents(infoLog) != "" {
+		t.Errorf("Debug went to the INFO log: %q", contents(infoLog))
+	}
+	Info("info")
+	if !contains(debugLog, "info", t) {
+		t.Error("Info did not cascade to the DEBUG log")
+	}
+}
+
 func TestInfoDepth(t *testing.T) {
 	setFlags()
 	defer logging.swap(logging.newBuffers())
@@ -156,6 +193,104 @@ func TestCopyStandardLogToPanic(t *testing.T) {
 	CopyStandardLogTo("LOG")
 }
 
+// Test that Writer logs each line with its own header.
+func TestWriter(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	w := Writer(WarningSeverity)
+	w.Write([]byte("first\nsec"))
+	if n := strings.Count(contents(warningLog), "\n"); n != 1 {
+		t.Fatalf("got %d lines before the partial line was completed, want 1: %q", n, contents(warningLog))
+	}
+	w.Write([]byte("ond\nthird\n"))
+	lines := strings.Split(strings.TrimSuffix(contents(warningLog), "\n"), "\n")
+	want := []string{"first", "second", "third"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %q", len(lines), len(want), contents(warningLog))
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "W") || !strings.Contains(line, "glog_test.go:") {
+			t.Errorf("line %d has a bad header: %q", i, line)
+		}
+		if !strings.HasSuffix(line, "] "+want[i]) {
+			t.Errorf("line %d: got %q, want message %q", i, line, want[i])
+		}
+	}
+}
+
+// Test that binding and restoring the standard log is safe under concurrency.
+func TestCopyStandardLogToConcurrent(t *testing.T) {
+	defer CopyStandardLogTo("INFO")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				switch (i + j) % 3 {
+				case 0:
+					CopyStandardLogTo("INFO")
+				case 1:
+					CopyStandardLogTo("WARNING")
+				case 2:
+					RestoreStandardLog()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	RestoreStandardLog()
+	if flags := stdLog.Flags(); flags != stdLog.LstdFlags {
+		t.Errorf("restored flags %d, want %d", flags, stdLog.LstdFlags)
+	}
+	RestoreStandardLog() // no-op when not bound
+
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	CopyStandardLogTo("WARNING")
+	CopyStandardLogTo("WARNING")
+	stdLog.Print("rebound")
+	if !contains(warningLog, "W", t) || !contains(warningLog, "rebound", t) {
+		t.Errorf("standard log not copied to WARNING: %q", contents(warningLog))
+	}
+}
+
+// Test that RedirectStdLog rejects bad names and honors severity prefixes.
+func TestRedirectStdLog(t *testing.T) {
+	defer CopyStandardLogTo("INFO")
+	if err := RedirectStdLog("LOG"); err == nil {
+		t.Error(`RedirectStdLog("LOG") succeeded`)
+	}
+
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	if err := RedirectStdLog("INFO"); err != nil {
+		t.Fatal(err)
+	}
+	stdLog.Print("[ERROR] disk full")
+	stdLog.Print("[WARN] slow peer")
+	stdLog.Print("[INFO] plain")
+	if !contains(errorLog, "] disk full", t) {
+		t.Errorf("[ERROR] line not logged as ERROR: %q", contents(errorLog))
+	}
+	if !contains(warningLog, "] slow peer", t) || contains(errorLog, "slow peer", t) {
+		t.Errorf("[WARN] line not logged as WARNING: %q", contents(warningLog))
+	}
+	if !contains(infoLog, "] [INFO] plain", t) || contains(warningLog, "plain", t) {
+		t.Errorf("unknown prefix changed the line: %q", contents(infoLog))
+	}
+
+	// Prefixes never lower the severity.
+	if err := RedirectStdLog("ERROR"); err != nil {
+		t.Fatal(err)
+	}
+	stdLog.Print("[WARN] still an error")
+	if !contains(errorLog, "still an error", t) {
+		t.Error("[WARN] prefix lowered the severity")
+	}
+}
+
 // Test that using the standard log package logs to INFO.
 func TestStandardLog(t *testing.T) {
 	setFlags()
@@ -174,22 +309,281 @@ func TestHeader(t *testing.T) {
 	setFlags()
 	defer logging.swap(logging.newBuffers())
 	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
 	timeNow = func() time.Time {
-		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
+		return now
 	}
 	pid = 1234
+	defer SetOutputFormat(FormatText)
+	for _, test := range []struct {
+		format Format
+		want   string
+	}{
+		{FormatText, "I0102 15:04:05.067890 logger/glog/glog_test.go:%d] test\n"},
+		{FormatJSON, `{"severity":"info","time":"` + now.Format(jsonTimeFormat) + `","file":"logger/glog/glog_test.go","line":%d,"pid":1234,"msg":"test"}` + "\n"},
+	} {
+		logging.newBuffers()
+		SetOutputFormat(test.format)
+		Info("test")
+		var line int
+		n, err := fmt.Sscanf(contents(infoLog), test.want, &line)
+		if n != 1 || err != nil {
+			t.Errorf("log format error: %d elements, error %s:\n%s", n, err, contents(infoLog))
+		}
+		// Scanf treats multiple spaces as equivalent to a single space,
+		// so check for correct space-padding also.
+		want := fmt.Sprintf(test.want, line)
+		if contents(infoLog) != want {
+			t.Errorf("log format error: got:\n\t%q\nwant:\t%q", contents(infoLog), want)
+		}
+	}
+}
+
+// Test that the time format and zone of headers can be changed.
+func TestSetTimeFormat(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.FixedZone("UTC-7", -7*3600))
+	timeNow = func() time.Time {
+		return now
+	}
+	defer SetTimeFormat("")
+	defer UseUTC(false)
+
+	for _, test := range []struct {
+		layout string
+		utc    bool
+		want   string
+	}{
+		{"", false, "I0102 15:04:05.067890 "},
+		{"", true, "I0102 22:04:05.067890 "},
+		{time.RFC3339, false, "I2006-01-02T15:04:05-07:00 "},
+		{time.RFC3339Nano, true, "I2006-01-02T22:04:05.06789Z "},
+	} {
+		logging.newBuffers()
+		SetTimeFormat(test.layout)
+		UseUTC(test.utc)
+		Info("test")
+		if !strings.HasPrefix(contents(infoLog), test.want) {
+			t.Errorf("layout %q, utc %v: got %q, want prefix %q", test.layout, test.utc, contents(infoLog), test.want)
+		}
+	}
+}
+
+// Test that the field separator replaces the spaces of the header.
+func TestSetFieldSeparator(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
+	timeNow = func() time.Time {
+		return now
+	}
+	defer SetFieldSeparator("")
+
+	SetFieldSeparator("\t")
 	Info("test")
 	var line int
-	format := "I0102 15:04:05.067890 logger/glog/glog_test.go:%d] test\n"
-	n, err := fmt.Sscanf(contents(infoLog), format, &line)
-	if n != 1 || err != nil {
-		t.Errorf("log format error: %d elements, error %s:\n%s", n, err, contents(infoLog))
+	if n, err := fmt.Sscanf(contents(infoLog), "I0102\t15:04:05.067890\tlogger/glog/glog_test.go:%d]\ttest\n", &line); n != 1 || err != nil {
+		t.Errorf("log format error: %d elements, error %v:\n%q", n, err, contents(infoLog))
+	}
+	if strings.Contains(contents(infoLog), " ") {
+		t.Errorf("line contains a space: %q", contents(infoLog))
+	}
+
+	logging.newBuffers()
+	SetFieldSeparator("")
+	Info("test")
+	if !strings.HasPrefix(contents(infoLog), "I0102 15:04:05.067890 logger/glog/glog_test.go:") || !strings.HasSuffix(contents(infoLog), "] test\n") {
+		t.Errorf("default separator changed the header: %q", contents(infoLog))
+	}
+}
+
+// Test that the epoch time modes write numeric timestamps.
+func TestSetTimeMode(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Unix(1136239445, .067890123e9)
+	timeNow = func() time.Time {
+		return now
+	}
+	defer SetTimeMode(TimeHuman)
+	defer SetTimeFormat("")
+
+	// The epoch modes override the layout.
+	SetTimeFormat(time.RFC3339)
+	for _, test := range []struct {
+		mode TimeMode
+		want string
+	}{
+		{TimeEpochMillis, "I1136239445067 logger/glog/glog_test.go:"},
+		{TimeEpochNanos, "I1136239445067890123 logger/glog/glog_test.go:"},
+		{TimeHuman, "I" + now.Format(time.RFC3339) + " logger/glog/glog_test.go:"},
+	} {
+		logging.newBuffers()
+		SetTimeMode(test.mode)
+		Info("test")
+		if !strings.HasPrefix(contents(infoLog), test.want) {
+			t.Errorf("mode %d: got %q, want prefix %q", test.mode, contents(infoLog), test.want)
+		}
+	}
+}
+
+// Test that a severity's prefix character and color can be remapped.
+func TestSetSeverityStyle(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetSeverityStyle(InfoSeverity, "I", "")
+	defer SetColor(ColorAuto)
+	SetColor(ColorAlways)
+	const green = "\x1b[32m"
+	if err := SetSeverityStyle(InfoSeverity, "N", green); err != nil {
+		t.Fatal(err)
+	}
+	Info("test")
+	if want := green + "N" + severityColorReset; !strings.HasPrefix(contents(infoLog), want) {
+		t.Errorf("Info has wrong prefix: got %q, want prefix %q", contents(infoLog), want)
+	}
+	if err := SetSeverityStyle(InfoSeverity, "NO", ""); err == nil {
+		t.Error("multi-character prefix accepted")
+	}
+	if err := SetSeverityStyle(numSeverity, "X", ""); err == nil {
+		t.Error("invalid severity accepted")
+	}
+}
+
+// Test that colors are only written where requested.
+func TestSetColor(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetSeverityStyle(InfoSeverity, "I", "")
+	defer SetColor(ColorAuto)
+	const green = "\x1b[32m"
+	SetSeverityStyle(InfoSeverity, "I", green)
+
+	for _, test := range []struct {
+		mode  ColorMode
+		color bool
+	}{
+		{ColorAuto, false}, // log files are not terminals
+		{ColorAlways, true},
+		{ColorNever, false},
+	} {
+		logging.newBuffers()
+		SetColor(test.mode)
+		Info("test")
+		if got := strings.HasPrefix(contents(infoLog), green); got != test.color {
+			t.Errorf("mode %d: colored = %v, want %v", test.mode, got, test.color)
+		}
+	}
+
+	// Standard error is not a terminal in tests; devices are.
+	if isTerminal(&bytes.Buffer{}) {
+		t.Error("buffer detected as a terminal")
+	}
+	if f, err := os.Open(os.DevNull); err == nil {
+		if !isTerminal(f) {
+			t.Errorf("%s not detected as a character device", os.DevNull)
+		}
+		f.Close()
+	}
+}
+
+// Test that header segments can be omitted.
+func TestSetHeaderParts(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
+	}
+	defer SetHeaderParts(HeaderAll)
+
+	for _, test := range []struct {
+		parts HeaderParts
+		want  string
+	}{
+		{HeaderSeverity | HeaderTime, "I0102 15:04:05.067890 test\n"},
+		{HeaderSeverity, "I test\n"},
+		{HeaderTime, "0102 15:04:05.067890 test\n"},
+		{0, "test\n"},
+	} {
+		logging.newBuffers()
+		SetHeaderParts(test.parts)
+		Info("test")
+		if got := contents(infoLog); got != test.want {
+			t.Errorf("parts %b: got %q, want %q", test.parts, got, test.want)
+		}
+	}
+	SetHeaderParts(HeaderLocation)
+	Info("test")
+	if !strings.Contains(contents(infoLog), "glog_test.go:") {
+		t.Errorf("location missing: %q", contents(infoLog))
+	}
+}
+
+// Test that a transform rewrites messages but not headers.
+func TestSetTransform(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetTransform(nil)
+	SetTransform(func(s Severity, msg string) string {
+		return strings.ToUpper(msg)
+	})
+	Info("test message")
+	if !contains(infoLog, "glog_test.go:", t) {
+		t.Errorf("header was transformed: %q", contents(infoLog))
+	}
+	if !strings.HasSuffix(contents(infoLog), "] TEST MESSAGE\n") {
+		t.Errorf("message not transformed: %q", contents(infoLog))
+	}
+	SetTransform(nil)
+	Info("plain")
+	if !strings.HasSuffix(contents(infoLog), "] plain\n") {
+		t.Errorf("transform not removed: %q", contents(infoLog))
+	}
+}
+
+// Test that formatted lines parse back to the same fields.
+func TestParseLine(t *testing.T) {
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
+	timeNow = func() time.Time { return now }
+	defer SetSeverityStyle(WarningSeverity, "W", "")
+
+	for _, want := range []Record{
+		{Severity: infoLog, Time: now, File: "core/blockchain.go", Line: 1358, Message: "imported 1 block"},
+		{Severity: errorLog, Time: now, File: "p2p/server.go", Line: 7, Message: "a] message: with separators"},
+		{Severity: warningLog, Time: now, File: "colored.go", Line: 1, Message: ""},
+	} {
+		if want.Severity == warningLog {
+			SetSeverityStyle(WarningSeverity, "W", "\x1b[33m")
+		}
+		buf := logging.formatHeader(want.Severity, want.File, want.Line)
+		buf.WriteString(want.Message + "\n")
+		got, err := ParseLine(buf.String())
+		if err != nil {
+			t.Errorf("ParseLine(%q): %v", buf.String(), err)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseLine(%q):\ngot  %+v\nwant %+v", buf.String(), got, want)
+		}
 	}
-	// Scanf treats multiple spaces as equivalent to a single space,
-	// so check for correct space-padding also.
-	want := fmt.Sprintf(format, line)
-	if contents(infoLog) != want {
-		t.Errorf("log format error: got:\n\t%q\nwant:\t%q", contents(infoLog), want)
+
+	for _, line := range []string{
+		"",
+		"I0102 15:04:05.067890 nolocation\n",
+		"X0102 15:04:05.067890 file.go:1] unknown severity\n",
+		"I01x2 15:04:05.067890 file.go:1] bad time\n",
+		"I0102 15:04:05.067890 file.go:x] bad line\n",
+		"\x1b[32mI",
+	} {
+		if _, err := ParseLine(line); err == nil {
+			t.Errorf("ParseLine(%q) succeeded", line)
+		}
 	}
 }
 
@@ -199,6 +593,8 @@ func TestHeader(t *testing.T) {
 func TestError(t *testing.T) {
 	setFlags()
 	defer logging.swap(logging.newBuffers())
+	defer SetFileThreshold(InfoSeverity)
+	SetFileThreshold(DebugSeverity)
 	Error("test")
 	if !contains(errorLog, "E", t) {
 		t.Errorf("Error has wrong character: %q", contents(errorLog))
@@ -213,6 +609,168 @@ func TestError(t *testing.T) {
 	if !contains(infoLog, str, t) {
 		t.Error("Info failed")
 	}
+	if !contains(debugLog, str, t) {
+		t.Error("Debug failed")
+	}
+}
+
+// failingWriter fails every Write.
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("failing")
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// Test that sinks receive the same lines as the files, in order.
+func TestSinks(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	var warn, info1, info2 bytes.Buffer
+	var order []*bytes.Buffer
+	record := func(buf *bytes.Buffer) io.Writer {
+		return writerFunc(func(p []byte) (int, error) {
+			order = append(order, buf)
+			return buf.Write(p)
+		})
+	}
+	removeWarn, err := AddSink(WarningSeverity, &warn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeWarn()
+	for _, w := range []io.Writer{failingWriter{}, record(&info1), record(&info2)} {
+		remove, err := AddSink(InfoSeverity, w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer remove()
+	}
+
+	Info("info")
+	Error("error")
+	if warn.String() != contents(warningLog) || !strings.Contains(warn.String(), "error") {
+		t.Errorf("WARNING sink got %q, file has %q", warn.String(), contents(warningLog))
+	}
+	if info1.String() != contents(infoLog) || info2.String() != contents(infoLog) {
+		t.Errorf("INFO sinks got %q and %q, file has %q", info1.String(), info2.String(), contents(infoLog))
+	}
+	if len(order) != 4 || order[0] != &info1 || order[1] != &info2 {
+		t.Errorf("sinks called out of order")
+	}
+
+	// Registrations of the same writer are removed separately.
+	removeAgain, _ := AddSink(WarningSeverity, &warn)
+	removeWarn()
+	removeWarn()
+	Warning("once")
+	if strings.Count(warn.String(), "once") != 1 {
+		t.Errorf("WARNING sink got %q, want one line", warn.String())
+	}
+	removeAgain()
+	Warning("after")
+	if strings.Contains(warn.String(), "after") {
+		t.Error("removed sink still receives lines")
+	}
+	if _, err := AddSink(Severity(numSeverity), &warn); err == nil {
+		t.Error("invalid severity accepted")
+	}
+}
+
+// Test that identical lines logged back to back are collapsed.
+func TestCollapseDuplicates(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetCollapseDuplicates(false)
+	SetCollapseDuplicates(true)
+
+	warn := func() { Warning("same") }
+	for i := 0; i < 4; i++ {
+		warn()
+	}
+	Info("interleaved") // runs are tracked per severity
+	warn()
+	Warning("different")
+	for i := 0; i < 3; i++ {
+		warn()
+	}
+	Flush() // ends the run in progress
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(contents(warningLog), "\n"), "\n") {
+		got = append(got, line[strings.Index(line, "] ")+2:])
+	}
+	want := []string{
+		"same",
+		"last message repeated 4 times",
+		"different",
+		"same",
+		"last message repeated 2 times",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("WARNING log has:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if !contains(infoLog, "] interleaved\n", t) {
+		t.Error("INFO line lost")
+	}
+}
+
+// Test that the count of a run directly follows the run when lines are
+// logged concurrently.
+func TestCollapseDuplicatesOrder(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetCollapseDuplicates(false)
+	SetCollapseDuplicates(true)
+
+	var wg sync.WaitGroup
+	for _, msg := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(msg string) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				Warning(msg)
+			}
+		}(msg)
+	}
+	wg.Wait()
+	Flush()
+
+	var last string
+	for _, line := range strings.Split(strings.TrimSuffix(contents(warningLog), "\n"), "\n") {
+		msg := line[strings.Index(line, "] ")+2:]
+		if strings.HasPrefix(msg, "last message repeated") {
+			// The count has the location of the repeated line.
+			if loc := line[:strings.Index(line, "] ")]; !strings.HasSuffix(last, loc[strings.LastIndex(loc, " "):]) {
+				t.Fatalf("%q does not follow its run, previous line is %q", line, last)
+			}
+		}
+		last = line[:strings.Index(line, "] ")]
+	}
+}
+
+// Test that with cascading off an Error log goes to the Error file only.
+func TestNoCascade(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetCascade(true)
+	SetCascade(false)
+	Error("test")
+	if !contains(errorLog, "test", t) {
+		t.Error("Error failed")
+	}
+	for _, s := range []Severity{infoLog, warningLog, fatalLog} {
+		if contents(s) != "" {
+			t.Errorf("Error cascaded to %s: %q", severityName[s], contents(s))
+		}
+	}
 }
 
 // Test that a Warning log goes to Info.
@@ -249,6 +807,34 @@ func TestV(t *testing.T) {
 	}
 }
 
+// Test that InfofFunc only builds its message when V is enabled.
+func TestVInfofFunc(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	logging.verbosity.Set("2")
+	defer logging.verbosity.Set("0")
+
+	calls := 0
+	fn := func() string {
+		calls++
+		return "expensive"
+	}
+	V(3).InfofFunc(fn)
+	if calls != 0 {
+		t.Errorf("fn called %d times for disabled V", calls)
+	}
+	if contents(infoLog) != "" {
+		t.Errorf("disabled V logged: %q", contents(infoLog))
+	}
+	V(2).InfofFunc(fn)
+	if calls != 1 {
+		t.Errorf("fn called %d times for enabled V, want 1", calls)
+	}
+	if !contains(infoLog, "glog_test.go:", t) || !contains(infoLog, "] expensive", t) {
+		t.Errorf("InfofFunc logged %q", contents(infoLog))
+	}
+}
+
 // Test that a vmodule enables a log in this file.
 func TestVmoduleOn(t *testing.T) {
 	setFlags()
@@ -327,6 +913,16 @@ var vGlobs = map[string]bool{
 
 	// These all use 2 and check the patterns.
 	"*=2": true,
+
+	// Negated patterns override the others, the last match winning.
+	"*=2,!logger/glog=1":                  false,
+	"!logger/glog=1,*=2":                  false,
+	"*=1,!logger/*=2":                     true,
+	"glog_test.go=2,!*=0":                 false,
+	"!logger/glog=1,!glog_test.go=2":      true,
+	"!glog_test.go=2,!logger/glog=1":      false,
+	"!p2p/discover=0,glog_test.go=2":      true,
+	"logger/glog=1,glog_test.go=2,!foo=3": false,
 }
 
 // Test that vmodule globbing works as advertised.
@@ -334,12 +930,85 @@ func testVmoduleGlob(pat string, match bool, t *testing.T) {
 	setFlags()
 	defer logging.swap(logging.newBuffers())
 	defer logging.vmodule.Set("")
+	defer SetV(Verbosity())
+	SetV(0)
 	logging.vmodule.Set(pat)
 	if V(2) != Verbose(match) {
 		t.Errorf("incorrect match for %q: got %t expected %t", pat, V(2), match)
 	}
 }
 
+// Test that verbosity can be changed at runtime.
+func TestSetVModule(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetVModule("")
+	defer SetV(0)
+
+	SetV(1)
+	if Verbosity() != 1 || !V(1) || V(2) {
+		t.Fatalf("verbosity 1 not applied: %d", Verbosity())
+	}
+	if err := SetVModule("glog_test.go=3"); err != nil {
+		t.Fatal(err)
+	}
+	if !V(3) || V(4) {
+		t.Error("vmodule not applied")
+	}
+	if err := SetVModule("glog_test.go"); err == nil {
+		t.Error("spec without level accepted")
+	}
+	if err := SetVModule("glog_test.go=-1"); err == nil {
+		t.Error("negative level accepted")
+	}
+
+	// Changes race with V.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			SetV(i % 4)
+			SetVModule(fmt.Sprintf("glog_test.go=%d", i%5))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			V(Level(i % 5))
+		}
+	}()
+	wg.Wait()
+}
+
+// Test that malformed vmodule specs are rejected with the offending clause.
+func TestSetVModuleErrors(t *testing.T) {
+	defer SetVModule("")
+	if err := SetVModule("glog_test.go=3"); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		spec, want string
+	}{
+		{"foo", `clause 1 "foo" at offset 0: expect pattern=N`},
+		{"a=1,foo=bar", `clause 2 "foo=bar" at offset 4: level "bar" is not a number`},
+		{"a=1,,=2", `clause 3 "=2" at offset 5: empty pattern`},
+		{"a=", `clause 1 "a=" at offset 0: missing level`},
+		{"a=1=2", `clause 1 "a=1=2" at offset 0: more than one '='`},
+		{"a=1,b=-1", `clause 2 "b=-1" at offset 4: negative level -1`},
+		{"*=3,!=0", `clause 2 "!=0" at offset 4: empty pattern`},
+	} {
+		err := SetVModule(test.spec)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("SetVModule(%q) = %v, want error containing %q", test.spec, err, test.want)
+		}
+	}
+	// The previous spec is kept.
+	if got := GetVModule().String(); !strings.Contains(got, "glog_test") {
+		t.Errorf("vmodule is %q after errors", got)
+	}
+}
+
 // Test that a vmodule globbing works as advertised.
 func TestVmoduleGlob(t *testing.T) {
 	for glob, match := range vGlobs {
@@ -392,6 +1061,1190 @@ func TestRollover(t *testing.T) {
 	}
 }
 
+// Test that OnRotate callbacks see rollovers.
+func TestOnRotate(t *testing.T) {
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 512
+	defer func() {
+		onRotate.Lock()
+		onRotate.fns = nil
+		onRotate.Unlock()
+	}()
+
+	Info("x") // Be sure we have a file.
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	fname0 := info.file.Name()
+
+	type call struct {
+		oldPath, newPath string
+		sev              Severity
+	}
+	var calls []call
+	OnRotate(func(oldPath, newPath string, s Severity) {
+		if s == infoLog {
+			calls = append(calls, call{oldPath, newPath, s})
+		}
+	})
+	OnRotate(func(oldPath, newPath string, s Severity) {
+		// Callbacks run in order and may log.
+		if s == infoLog && len(calls) == 1 {
+			Info("rotated")
+		}
+	})
+	Info(strings.Repeat("x", int(MaxSize))) // force a rollover
+	if err != nil {
+		t.Fatalf("info has error after big write: %v", err)
+	}
+	// The line logged by the callback rotates the full file again.
+	if len(calls) != 2 {
+		t.Fatalf("callback called %d times for INFO, want 2", len(calls))
+	}
+	if calls[0].oldPath != fname0 || calls[0].newPath == fname0 {
+		t.Errorf("callback saw %s -> %s, want %s -> new file", calls[0].oldPath, calls[0].newPath, fname0)
+	}
+	if calls[1].oldPath != calls[0].newPath || calls[1].newPath != info.file.Name() {
+		t.Errorf("callback saw %s -> %s, want %s -> %s", calls[1].oldPath, calls[1].newPath, calls[0].newPath, info.file.Name())
+	}
+}
+
+// Test that an OnRotate callback may log while duplicates are collapsed.
+func TestOnRotateCollapse(t *testing.T) {
+	setFlags()
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 512
+	defer SetCollapseDuplicates(false)
+	SetCollapseDuplicates(true)
+	defer func() {
+		onRotate.Lock()
+		onRotate.fns = nil
+		onRotate.Unlock()
+	}()
+
+	Info("x") // Be sure we have a file.
+	var calls int
+	OnRotate(func(oldPath, newPath string, s Severity) {
+		if s == infoLog {
+			calls++
+			Info("rotated")
+		}
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Info(strings.Repeat("x", int(MaxSize))) // force a rollover
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("logging from OnRotate deadlocked")
+	}
+	if calls == 0 {
+		t.Error("callback not called")
+	}
+}
+
+// Test that files can be rotated on demand.
+func TestRotate(t *testing.T) {
+	setFlags()
+	Info("x") // Be sure we have a file.
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	fname0 := info.file.Name()
+	if err := Rotate(infoLog); err != nil {
+		t.Fatal(err)
+	}
+	fname1 := info.file.Name()
+	if fname0 == fname1 {
+		t.Errorf("info.f.Name did not change: %v", fname0)
+	}
+	if err := RotateAll(); err != nil {
+		t.Fatal(err)
+	}
+	if info.file.Name() == fname1 {
+		t.Errorf("info.f.Name did not change on RotateAll: %v", fname1)
+	}
+	if err := Rotate(Severity(numSeverity)); err == nil {
+		t.Error("invalid severity accepted")
+	}
+}
+
+// Test that rotation sizes can be set per severity.
+func TestShouldRotate(t *testing.T) {
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 1000
+	defer SetRotation(infoLog, RotationConfig{})
+	defer SetRotation(errorLog, RotationConfig{})
+	if err := SetRotation(infoLog, RotationConfig{MaxSize: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRotation(numSeverity, RotationConfig{}); err == nil {
+		t.Error("invalid severity accepted")
+	}
+
+	for _, test := range []struct {
+		sev    Severity
+		tag    string
+		nbytes uint64
+		n      int
+		want   bool
+	}{
+		{infoLog, "INFO", 0, 99, false},
+		{infoLog, "INFO", 50, 50, true},
+		{errorLog, "ERROR", 50, 50, false},
+		{errorLog, "ERROR", 900, 100, true},
+		{infoLog, combinedTag, 50, 50, false}, // the combined file uses MaxSize
+	} {
+		sb := &syncBuffer{logger: &logging, sev: test.sev, tag: test.tag, nbytes: test.nbytes}
+		if got := sb.shouldRotate(test.n); got != test.want {
+			t.Errorf("%s file at %d bytes, writing %d: got %t, want %t", test.tag, test.nbytes, test.n, got, test.want)
+		}
+	}
+}
+
+// Test that RotationCron rotates files at the scheduled times.
+func TestShouldRotateCron(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2006, 1, 2, 18, 30, 0, 0, time.Local)}
+	defer SetClock(nil)
+	SetClock(clock)
+	defer func(previous string) { RotationCron = previous }(RotationCron)
+	RotationCron = "0 0,12 * * *" // twice a day
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 1000
+
+	sb := &syncBuffer{logger: &logging, sev: infoLog, tag: "INFO"}
+	sb.rotateAt = logging.nextRotation(sb.cronExpr(), clock.Now())
+	for _, test := range []struct {
+		advance time.Duration
+		nbytes  uint64
+		want    bool
+	}{
+		{0, 0, false},
+		{5*time.Hour + 29*time.Minute, 0, false}, // 23:59
+		{0, 999, true},                           // MaxSize still applies
+		{time.Minute, 0, true},                   // midnight, next day
+		{12 * time.Hour, 0, true},
+	} {
+		clock.Advance(test.advance)
+		sb.nbytes = test.nbytes
+		if got := sb.shouldRotate(1); got != test.want {
+			t.Errorf("at %v with %d bytes: got %t, want %t", clock.Now(), test.nbytes, got, test.want)
+		}
+	}
+
+	// After a rotation at midnight the next one is due at noon.
+	sb.rotateAt = logging.nextRotation(sb.cronExpr(), time.Date(2006, 1, 3, 0, 0, 0, 0, time.Local))
+	if want := time.Date(2006, 1, 3, 12, 0, 0, 0, time.Local); !sb.rotateAt.Equal(want) {
+		t.Errorf("next rotation at %v, want %v", sb.rotateAt, want)
+	}
+}
+
+// Test that RotationConfig.Cron overrides RotationCron per severity.
+func TestRotationCronPerSeverity(t *testing.T) {
+	defer func(previous string) { RotationCron = previous }(RotationCron)
+	RotationCron = "0 0 * * *" // daily
+	defer SetRotation(errorLog, RotationConfig{})
+	if err := SetRotation(errorLog, RotationConfig{Cron: "0 0 * * 0"}); err != nil { // weekly
+		t.Fatal(err)
+	}
+	if err := SetRotation(errorLog, RotationConfig{Cron: "0 25 * * *"}); err == nil {
+		t.Error("invalid cron expression accepted")
+	}
+
+	now := time.Date(2006, 1, 2, 18, 30, 0, 0, time.Local) // a Monday
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	for _, test := range []struct {
+		sev  Severity
+		tag  string
+		want time.Time
+	}{
+		{infoLog, "INFO", time.Date(2006, 1, 3, 0, 0, 0, 0, time.Local)},
+		{errorLog, "ERROR", time.Date(2006, 1, 8, 0, 0, 0, 0, time.Local)},
+		{errorLog, combinedTag, time.Date(2006, 1, 3, 0, 0, 0, 0, time.Local)}, // the combined file uses RotationCron
+	} {
+		sb := &syncBuffer{logger: &logging, sev: test.sev, tag: test.tag}
+		if got := logging.nextRotation(sb.cronExpr(), now); !got.Equal(test.want) {
+			t.Errorf("%s file: next rotation at %v, want %v", test.tag, got, test.want)
+		}
+	}
+}
+
+// Test that cron expressions are parsed and evaluated like cron does.
+func TestCronNext(t *testing.T) {
+	from := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC) // a Monday
+	for _, test := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2006, 1, 2, 15, 5, 0, 0, time.UTC)},
+		{"0 0,12 * * *", time.Date(2006, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"*/15 9-17 * * *", time.Date(2006, 1, 2, 15, 15, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2006, 1, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2006, 1, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2006, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 1 1", time.Date(2006, 1, 9, 0, 0, 0, 0, time.UTC)}, // day of month or week
+		{"30 4 29 2 *", time.Date(2008, 2, 29, 4, 30, 0, 0, time.UTC)},
+	} {
+		c, err := parseCron(test.expr)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+			continue
+		}
+		if got, err := c.next(from); err != nil || !got.Equal(test.want) {
+			t.Errorf("%q: next is %v (%v), want %v", test.expr, got, err, test.want)
+		}
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q accepted", expr)
+		}
+	}
+	c, _ := parseCron("0 0 30 2 *")
+	if _, err := c.next(from); err != errNoCronTime {
+		t.Errorf("February 30 matched: %v", err)
+	}
+}
+
+// Test that the combined file receives the lines of every severity.
+func TestCombinedFile(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetCombinedFile(false)
+	SetCombinedFile(true)
+	combined := new(flushBuffer)
+	logging.combined = combined
+
+	Info("info line")
+	Error("error line")
+	for _, test := range []struct {
+		sev Severity
+		msg string
+	}{
+		{infoLog, "info line"},
+		{errorLog, "error line"},
+	} {
+		if !contains(test.sev, test.msg, t) {
+			t.Errorf("%s missing from %s log: %q", test.msg, severityName[test.sev], contents(test.sev))
+		}
+		if !strings.Contains(combined.String(), test.msg) {
+			t.Errorf("%s missing from combined log: %q", test.msg, combined.String())
+		}
+	}
+	if n := strings.Count(combined.String(), "error line"); n != 1 {
+		t.Errorf("error line appears %d times in combined log, want 1", n)
+	}
+}
+
+// Test that the combined file is created with the ALL tag.
+func TestCombinedFileCreate(t *testing.T) {
+	setFlags()
+	defer SetCombinedFile(false)
+	SetCombinedFile(true)
+	Info("x")
+	sb, ok := logging.combined.(*syncBuffer)
+	if !ok {
+		t.Fatal("combined file wasn't created")
+	}
+	if name := sb.file.Name(); !strings.Contains(name, ".log.ALL.") {
+		t.Errorf("combined file has wrong name %s", name)
+	}
+}
+
+// Test that numeric thresholds keep their meaning from before DEBUG.
+func TestSeveritySet(t *testing.T) {
+	defer logging.stderrThreshold.set(logging.stderrThreshold.get())
+	for _, test := range []struct {
+		value string
+		want  Severity
+	}{
+		{"0", infoLog},
+		{"1", warningLog},
+		{"2", errorLog},
+		{"3", fatalLog},
+		{"debug", debugLog},
+		{"WARNING", warningLog},
+	} {
+		var s Severity
+		if err := s.Set(test.value); err != nil {
+			t.Errorf("Set(%q): %v", test.value, err)
+			continue
+		}
+		if got := logging.stderrThreshold.get(); got != test.want {
+			t.Errorf("Set(%q) set %s, want %s", test.value, severityName[got], severityName[test.want])
+		}
+		if got := logging.stderrThreshold.String(); got != severityName[test.want] {
+			t.Errorf("String() after Set(%q) = %q", test.value, got)
+		}
+	}
+	for _, value := range []string{"-1", "4", "verbose"} {
+		var s Severity
+		if err := s.Set(value); err == nil {
+			t.Errorf("Set(%q) accepted", value)
+		}
+	}
+}
+
+// Test that Enabled matches whether a line is actually written.
+func TestEnabled(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	for _, s := range []Severity{DebugSeverity, InfoSeverity, WarningSeverity, ErrorSeverity} {
+		logging.swap(logging.newBuffers())
+		logging.printDepth(s, 0, "enabled")
+		if landed := contains(s, "enabled", t); Enabled(s) != landed {
+			t.Errorf("Enabled(%s) = %v, but line landed = %v", severityName[s], Enabled(s), landed)
+		}
+	}
+	if !Enabled(FatalSeverity) {
+		t.Error("FATAL not enabled")
+	}
+	if Enabled(Severity(numSeverity)) || Enabled(Severity(-1)) {
+		t.Error("invalid severity enabled")
+	}
+
+	// Lines below the file and stderr thresholds go nowhere.
+	defer SetFileThreshold(InfoSeverity)
+	SetFileThreshold(WarningSeverity)
+	if Enabled(InfoSeverity) {
+		t.Error("INFO enabled below the file threshold")
+	}
+	if !Enabled(WarningSeverity) {
+		t.Error("WARNING not enabled at the file threshold")
+	}
+	// Unless something else receives them.
+	m := NewMemorySink()
+	defer SetSink(DebugSeverity, nil)
+	SetSink(DebugSeverity, m)
+	if !Enabled(InfoSeverity) {
+		t.Error("INFO not enabled with a DEBUG sink")
+	}
+	SetSink(DebugSeverity, nil)
+	SetAlsoToStderr(true)
+	defer SetAlsoToStderr(false)
+	if !Enabled(DebugSeverity) {
+		t.Error("DEBUG not enabled with alsologtostderr")
+	}
+}
+
+// Test that Enabled does not wait for the logging lock.
+func TestEnabledLockFree(t *testing.T) {
+	done := make(chan bool, 1)
+	logging.mu.Lock()
+	go func() { done <- Enabled(ErrorSeverity) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("Enabled blocked on logging.mu")
+	}
+	logging.mu.Unlock()
+}
+
+// stderrRecorder records each Write as a separate chunk and detects
+// concurrent writes.
+type stderrRecorder struct {
+	inflight int32
+	overlaps int32
+	mu       sync.Mutex
+	chunks   []string
+}
+
+func (r *stderrRecorder) Write(p []byte) (int, error) {
+	if atomic.AddInt32(&r.inflight, 1) > 1 {
+		atomic.AddInt32(&r.overlaps, 1)
+	}
+	r.mu.Lock()
+	r.chunks = append(r.chunks, string(p))
+	r.mu.Unlock()
+	atomic.AddInt32(&r.inflight, -1)
+	return len(p), nil
+}
+
+// Test that lines logged concurrently to standard error never interleave.
+func TestStderrLineAtomic(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous io.Writer) { stderr = previous }(stderr)
+	rec := new(stderrRecorder)
+	stderr = rec
+	logging.toStderr = true
+	defer func() { logging.toStderr = false }()
+
+	const goroutines, lines = 16, 200
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < lines; i++ {
+				Warningf("goroutine %d line %d %s", g, i, strings.Repeat("x", i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if rec.overlaps != 0 {
+		t.Errorf("%d concurrent writes to stderr", rec.overlaps)
+	}
+	if len(rec.chunks) != goroutines*lines {
+		t.Fatalf("got %d writes, want %d", len(rec.chunks), goroutines*lines)
+	}
+	for _, chunk := range rec.chunks {
+		if chunk[0] != 'W' || strings.Count(chunk, "\n") != 1 || !strings.HasSuffix(chunk, "\n") {
+			t.Fatalf("corrupt line %q", chunk)
+		}
+	}
+}
+
+// Test that BytesWritten accumulates across rotations.
+func TestBytesWritten(t *testing.T) {
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	Info("x") // Be sure we have a file.
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	total, size := BytesWritten()[infoLog], info.nbytes
+
+	Info(strings.Repeat("y", 100))
+	if got, want := BytesWritten()[infoLog]-total, info.nbytes-size; got != want {
+		t.Errorf("counted %d bytes, file grew by %d", got, want)
+	}
+	total = BytesWritten()[infoLog]
+
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = info.nbytes + 1
+	Info("z") // force a rollover
+	if err != nil {
+		t.Fatalf("error after rotation: %v", err)
+	}
+	// After the rotation the file holds only its header and the new line.
+	if got := BytesWritten()[infoLog] - total; got != info.nbytes {
+		t.Errorf("counted %d bytes after rotation, new file has %d", got, info.nbytes)
+	}
+	if BytesWritten()[infoLog] <= info.nbytes {
+		t.Error("counter was reset on rotation")
+	}
+}
+
+// fakeClock is a Clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Test that headers, file names and rotation all follow the clock.
+func TestClock(t *testing.T) {
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	clock := &fakeClock{now: time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)}
+	SetClock(clock)
+	defer SetClock(nil)
+
+	Info("x") // Be sure we have a file.
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = info.nbytes + 1
+	Info("force a rollover")
+	if err != nil {
+		t.Fatalf("error after rotation: %v", err)
+	}
+	if name := info.file.Name(); !strings.Contains(name, ".20060102-150405.") {
+		t.Errorf("file name %s does not use the clock", name)
+	}
+
+	clock.Advance(time.Hour)
+	MaxSize = info.nbytes + 1
+	Info("force another rollover")
+	if name := info.file.Name(); !strings.Contains(name, ".20060102-160405.") {
+		t.Errorf("file name %s does not follow the advanced clock", name)
+	}
+
+	defer logging.swap(logging.newBuffers())
+	Info("header")
+	if !strings.HasPrefix(contents(infoLog), "I0102 16:04:05.000000 ") {
+		t.Errorf("header does not use the clock: %q", contents(infoLog))
+	}
+}
+
+// Test that an instance ID replaces the pid in log file names.
+func TestSetInstanceID(t *testing.T) {
+	defer func(previous int) { pid = previous }(pid)
+	pid = 1234
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	if name, _ := logName("INFO", now); !strings.HasSuffix(name, ".log.INFO.20060102-150405.1234") {
+		t.Errorf("default name %s does not end in the pid", name)
+	}
+	defer SetInstanceID("")
+	SetInstanceID("geth/7f9c")
+	if name, _ := logName("INFO", now); !strings.HasSuffix(name, ".log.INFO.20060102-150405.geth_7f9c") {
+		t.Errorf("name %s does not end in the instance ID", name)
+	}
+	SetInstanceID("")
+	if name, _ := logName("INFO", now); !strings.HasSuffix(name, ".1234") {
+		t.Errorf("name %s does not end in the pid after reset", name)
+	}
+}
+
+// Test that creating a log file whose name is taken yields a distinct file
+// and leaves the existing one untouched.
+func TestCreateCollision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir}
+
+	now := time.Now()
+	f0, name0, err := create("INFO", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f0.Close()
+	f0.WriteString("first process\n")
+
+	// A second process starting in the same second gets the same name.
+	f1, name1, err := create("INFO", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+	if name0 == name1 {
+		t.Fatalf("both processes got %s", name0)
+	}
+	if want := name0 + ".1"; name1 != want {
+		t.Errorf("got disambiguated name %s, want %s", name1, want)
+	}
+	if data, _ := ioutil.ReadFile(name0); string(data) != "first process\n" {
+		t.Errorf("first file was clobbered: %q", data)
+	}
+	_, link := logName("INFO", now)
+	if target, err := os.Readlink(filepath.Join(dir, link)); err != nil || target != filepath.Base(name1) {
+		t.Errorf("symlink points to %q (%v), want %q", target, err, filepath.Base(name1))
+	}
+}
+
+// Test that lines reach the disk within FlushInterval, or immediately if
+// it is zero, and that Shutdown closes the files.
+func TestFlushInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	setFlags()
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir}
+	defer func(previous time.Duration) { FlushInterval = previous }(FlushInterval)
+	defer Shutdown()
+
+	onDisk := func(msg string) bool {
+		logging.mu.Lock()
+		name := logging.file[infoLog].(*syncBuffer).file.Name()
+		logging.mu.Unlock()
+		data, _ := ioutil.ReadFile(name)
+		return strings.Contains(string(data), msg)
+	}
+
+	Shutdown()
+	FlushInterval = 0
+	Info("unbuffered")
+	if !onDisk("unbuffered") {
+		t.Error("line not flushed with FlushInterval = 0")
+	}
+
+	Shutdown()
+	FlushInterval = 10 * time.Millisecond
+	Info("periodic")
+	for deadline := time.Now().Add(5 * time.Second); !onDisk("periodic"); {
+		if time.Now().After(deadline) {
+			t.Fatal("line not flushed by the flush daemon")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	FlushInterval = time.Hour
+	Shutdown()
+	if logging.flushQuit != nil {
+		t.Error("flush daemon still running")
+	}
+	if logging.file[infoLog] != nil {
+		t.Error("INFO file still open")
+	}
+}
+
+// Test that Close closes the log files and reverts to stderr.
+func TestClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	setFlags()
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir}
+	defer func(previous io.Writer) { stderr = previous }(stderr)
+	out := new(bytes.Buffer)
+	stderr = out
+	defer SetToStderr(false)
+	defer Shutdown()
+
+	Shutdown()
+	Info("before close")
+	name, err := CurrentLogFile("INFO")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Log concurrently with Close, the race detector and the closed
+	// files catch unsynchronized writes.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			Info("during close")
+		}
+	}()
+	Close()
+	Close()
+	wg.Wait()
+
+	logging.mu.Lock()
+	if logging.file[infoLog] != nil {
+		t.Error("INFO file still open")
+	}
+	logging.mu.Unlock()
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "before close") {
+		t.Error("line logged before Close not on disk")
+	}
+	Info("after close")
+	if !strings.Contains(out.String(), "after close") {
+		t.Error("line logged after Close not written to stderr")
+	}
+	if _, err := CurrentLogFile("INFO"); err == nil {
+		t.Error("log file reopened after Close")
+	}
+}
+
+// Test that Close writes the queued lines and pending repeat summaries to
+// the files rather than to standard error.
+func TestCloseDrains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	setFlags()
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir}
+	defer func(previous io.Writer) { stderr = previous }(stderr)
+	out := new(bytes.Buffer)
+	stderr = out
+	defer SetToStderr(false)
+	defer Shutdown()
+	defer SetCollapseDuplicates(false)
+	SetCollapseDuplicates(true)
+
+	Shutdown()
+	Info("first")
+	name, err := CurrentLogFile("INFO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		Info("repeated")
+	}
+	SetAsync(100)
+	Info("queued")
+	Close()
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"repeated 2 times", "queued"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("%q not in log file:\n%s", want, data)
+		}
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected output on stderr: %q", out.String())
+	}
+}
+
+// Test that the paths of the current log files are reported.
+func TestCurrentLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	setFlags()
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir}
+	defer Shutdown()
+
+	Shutdown()
+	if _, err := CurrentLogFile("info"); err == nil {
+		t.Error("no error before the file was created")
+	}
+	if got := LogDir(); got != dir {
+		t.Errorf("LogDir() = %q before logging, want %q", got, dir)
+	}
+	Warning("test")
+	name, err := CurrentLogFile("WARNING")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(name) || filepath.Dir(name) != dir || !strings.Contains(name, ".log.WARNING.") {
+		t.Errorf("CurrentLogFile(WARNING) = %q", name)
+	}
+	if got := LogDir(); got != dir {
+		t.Errorf("LogDir() = %q, want %q", got, dir)
+	}
+	if _, err := CurrentLogFile("ERROR"); err == nil {
+		t.Error("no error for a severity without a file")
+	}
+	if _, err := CurrentLogFile("VERBOSE"); err == nil {
+		t.Error("no error for an unknown severity")
+	}
+}
+
+// Test that only MaxBackups rotated files are kept.
+func TestMaxBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir}
+	defer func(previous int) { MaxBackups = previous }(MaxBackups)
+	MaxBackups = 2
+
+	start := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	// An old compressed file and a file not named like a log file.
+	gz, _ := logName("INFO", start.Add(-time.Hour))
+	unrelated := logFilePrefix("INFO") + "notes.txt"
+	for _, name := range []string{gz + ".gz", unrelated} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sb := &syncBuffer{logger: &logging, sev: infoLog, tag: "INFO"}
+	for i := 0; i < 5; i++ {
+		if err := sb.rotateFile(start.Add(time.Duration(i) * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sb.file.Close()
+
+	var want []string
+	for i := 2; i < 5; i++ {
+		name, _ := logName("INFO", start.Add(time.Duration(i)*time.Second))
+		want = append(want, name)
+	}
+	want = append(want, unrelated)
+	_, link := logName("INFO", start)
+	want = append(want, link)
+	sort.Strings(want)
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fi := range infos {
+		got = append(got, fi.Name())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("files left:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// Test that a compressed file and its original count as one backup.
+func TestMaxBackupsCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(previous int) { MaxBackups = previous }(MaxBackups)
+
+	start := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	var names []string
+	for i, suffix := range []string{"", "", ".gz", ""} {
+		name, _ := logName("INFO", start.Add(time.Duration(i/2+i%2)*time.Minute))
+		names = append(names, name+suffix)
+		if err := ioutil.WriteFile(filepath.Join(dir, name+suffix), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// names holds the generations at 0m, 1m (plain and compressed) and 2m.
+	current, _ := logName("INFO", start.Add(time.Hour))
+	current = filepath.Join(dir, current)
+
+	for _, test := range []struct {
+		maxBackups int
+		deleted    []bool
+	}{
+		{3, []bool{false, false, false, false}},
+		{2, []bool{true, false, false, false}},
+		{1, []bool{true, true, true, false}},
+	} {
+		MaxBackups = test.maxBackups
+		logging.mu.Lock()
+		err := pruneBackups("INFO", current)
+		logging.mu.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, name := range names {
+			_, err := os.Stat(filepath.Join(dir, name))
+			if deleted := os.IsNotExist(err); deleted != test.deleted[i] {
+				t.Errorf("MaxBackups %d: %s deleted: %t", test.maxBackups, name, deleted)
+			}
+		}
+	}
+}
+
+// Test that pruning leaves alone the files of other processes created
+// since this one started.
+func TestPruneOtherProcesses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(previous int) { MaxBackups = previous }(MaxBackups)
+	MaxBackups = 1
+
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	prefix := logFilePrefix("INFO")
+	old := startTime.Add(-time.Hour).Format(timestampLayout)
+	recent := startTime.Add(time.Second).Format(timestampLayout)
+	other := strconv.Itoa(pid + 1)
+	own := strconv.Itoa(pid)
+	names := []string{
+		prefix + old + "." + other,          // left behind by another process
+		prefix + old + "." + own,            // ours
+		prefix + recent + "." + other,       // another process may be running
+		prefix + recent + "." + other + "1", // ditto, not ours despite the prefix
+		prefix + recent + "." + own + ".1",  // ours, disambiguated
+		prefix + recent + "." + own + ".gz", // ours, compressed
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	current := filepath.Join(dir, prefix+recent+".current")
+	if err := pruneBackups("INFO", current); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if deleted := os.IsNotExist(err); deleted != (i < 2 || i == 4) {
+			t.Errorf("%s deleted: %t", name, deleted)
+		}
+	}
+}
+
+// Test that old log files are deleted to stay within MaxTotalSize.
+func TestMaxTotalSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir}
+	defer func(previous uint64) { MaxTotalSize = previous }(MaxTotalSize)
+
+	start := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	var old []string
+	for i, tag := range []string{"WARNING", "INFO", "ERROR", "INFO"} {
+		name, _ := logName(tag, start.Add(time.Duration(i)*time.Minute))
+		old = append(old, name)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), make([]byte, 1000), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unrelated := logFilePrefix("INFO") + "notes.txt"
+	if err := ioutil.WriteFile(filepath.Join(dir, unrelated), make([]byte, 5000), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new file and the two newest old files fit.
+	MaxTotalSize = 2500
+	sb := &syncBuffer{logger: &logging, sev: infoLog, tag: "INFO"}
+	if err := sb.rotateFile(start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	defer sb.file.Close()
+	if err := LastPruneError(); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range old {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if deleted := os.IsNotExist(err); deleted != (i < 2) {
+			t.Errorf("file %d deleted: %v", i, deleted)
+		}
+	}
+	for _, name := range []string{unrelated, filepath.Base(sb.file.Name())} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was deleted", name)
+		}
+	}
+
+	// Errors are recorded.
+	logging.mu.Lock()
+	logging.prune("INFO", filepath.Join(dir, "missing", "file"))
+	logging.mu.Unlock()
+	if LastPruneError() == nil {
+		t.Error("no error for missing directory")
+	}
+	logging.mu.Lock()
+	logging.pruneErr = nil
+	logging.mu.Unlock()
+}
+
+// Test that time stamps are parsed from log file names.
+func TestExtractTimestamp(t *testing.T) {
+	prefix := logFilePrefix("INFO")
+	want := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	for _, test := range []struct {
+		name string
+		ok   bool
+	}{
+		{prefix + "20060102-150405.1234", true},
+		{prefix + "20060102-150405.1234.1", true},
+		{prefix + "20060102-150405.1234.gz", true},
+		{prefix + "20061302-150405.1234", false},
+		{prefix + "2006", false},
+		{logFilePrefix("WARNING") + "20060102-150405.1234", false},
+	} {
+		got, ok := extractTimestamp(test.name, prefix)
+		if ok != test.ok || (ok && !got.Equal(want)) {
+			t.Errorf("extractTimestamp(%q) = %v, %v", test.name, got, ok)
+		}
+	}
+}
+
+// Test that the components of log file names can be overridden.
+func TestSetHost(t *testing.T) {
+	defer SetProgramName("")
+	defer SetHost("")
+	defer SetUser("")
+
+	SetProgramName("geth_test")
+	SetHost("sampleHost.internal.example")
+	SetUser("sample/User")
+	logging.mu.Lock()
+	prefix := logFilePrefix("INFO")
+	name, _ := logName("INFO", time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local))
+	logging.mu.Unlock()
+	if want := "geth_test.sampleHost.sample_User.log.INFO."; prefix != want {
+		t.Errorf("prefix is %q, want %q", prefix, want)
+	}
+	if got, ok := extractTimestamp(name, prefix); !ok || !got.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)) {
+		t.Errorf("extractTimestamp(%q) = %v, %v", name, got, ok)
+	}
+	for _, test := range []struct {
+		name string
+		ok   bool
+	}{
+		{prefix + "20060102-150405.1234", true},
+		{"geth_test.sampleHost.internal.example.sample_User.log.INFO.20060102-150405.1234", false},
+	} {
+		if _, ok := extractTimestamp(test.name, prefix); ok != test.ok {
+			t.Errorf("extractTimestamp(%q) reports %v, want %v", test.name, ok, test.ok)
+		}
+	}
+
+	SetHost("")
+	logging.mu.Lock()
+	restored := host
+	logging.mu.Unlock()
+	if restored != detectHost() {
+		t.Errorf("host is %q after reset, want %q", restored, detectHost())
+	}
+}
+
+// Test that the output counters count lines and bytes per severity.
+func TestStats(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	ResetStats()
+	for i := 0; i < 3; i++ {
+		Info("counted")
+	}
+	Warning("counted")
+	if n := Stats.Info.Lines(); n != 3 {
+		t.Errorf("Stats.Info.Lines() = %d, want 3", n)
+	}
+	if n := Stats.Warning.Lines(); n != 1 {
+		t.Errorf("Stats.Warning.Lines() = %d, want 1", n)
+	}
+	if n := Stats.Error.Lines(); n != 0 {
+		t.Errorf("Stats.Error.Lines() = %d, want 0", n)
+	}
+	if n, want := Stats.Warning.Bytes(), int64(len(contents(warningLog))); n != want {
+		t.Errorf("Stats.Warning.Bytes() = %d, want %d", n, want)
+	}
+	ResetStats()
+	if Stats.Info.Lines() != 0 || Stats.Info.Bytes() != 0 {
+		t.Error("counters not reset")
+	}
+}
+
+// Test that lines below the file threshold reach stderr but not the files.
+func TestFileThreshold(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous io.Writer) { stderr = previous }(stderr)
+	out := new(bytes.Buffer)
+	stderr = out
+	defer SetAlsoToStderr(false)
+	defer SetFileThreshold(InfoSeverity)
+
+	SetAlsoToStderr(true)
+	SetFileThreshold(WarningSeverity)
+	Info("info line")
+	Warning("warning line")
+	if !strings.Contains(out.String(), "info line") {
+		t.Error("INFO line not written to stderr")
+	}
+	if contains(infoLog, "info line", t) {
+		t.Error("INFO line written to the INFO file")
+	}
+	if !contains(warningLog, "warning line", t) || !contains(infoLog, "warning line", t) {
+		t.Error("WARNING line not written to the files")
+	}
+}
+
+// Test that the DEBUG file is only written once debug output is enabled.
+func TestDebugFileDisabled(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetV(Verbosity())
+
+	Debug("hidden")
+	Info("info line")
+	if contents(debugLog) != "" {
+		t.Errorf("DEBUG log written by default: %q", contents(debugLog))
+	}
+	if !contains(infoLog, "info line", t) {
+		t.Error("INFO line not written to the INFO file")
+	}
+
+	SetV(int(debugVerbosity))
+	Debug("shown")
+	Info("cascaded")
+	if !contains(debugLog, "shown", t) || !contains(debugLog, "cascaded", t) {
+		t.Errorf("DEBUG log not written at debug verbosity: %q", contents(debugLog))
+	}
+
+	// Only the INFO file is created when an INFO line is logged.
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir}
+	SetV(3)
+	logging.swap([numSeverity]flushSyncWriter{})
+	Info("no debug file")
+	files := logging.newBuffers()
+	for _, f := range files {
+		if sb, ok := f.(*syncBuffer); ok {
+			sb.file.Close()
+		}
+	}
+	if files[infoLog] == nil {
+		t.Error("INFO file not created")
+	}
+	if files[debugLog] != nil {
+		t.Error("DEBUG file created by default")
+	}
+}
+
+// Test that lines at or above the threshold carry a stack trace.
+func TestStacktraceThreshold(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetStacktraceThreshold(FatalSeverity)
+
+	const frame = "glog.TestStacktraceThreshold"
+	Error("default")
+	if contains(errorLog, frame, t) {
+		t.Error("stack trace written by default")
+	}
+	SetStacktraceThreshold(ErrorSeverity)
+	logging.newBuffers()
+	Warning("warning")
+	V(0).Info("verbose")
+	if contains(infoLog, frame, t) {
+		t.Errorf("stack trace below the threshold:\n%s", contents(infoLog))
+	}
+	Error("error")
+	if !contains(errorLog, "] error\ngoroutine ", t) || !contains(errorLog, frame, t) {
+		t.Errorf("no stack trace after error:\n%s", contents(errorLog))
+	}
+}
+
 func TestLogBacktraceAt(t *testing.T) {
 	setFlags()
 	defer logging.swap(logging.newBuffers())
@@ -0,0 +1,129 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vmoduleWatchInterval is how often a watched vmodule file is checked for
+// changes. Tests shorten it.
+var vmoduleWatchInterval = time.Second
+
+// vmoduleWatch tracks the watcher started by WatchVModuleFile.
+var vmoduleWatch struct {
+	sync.Mutex
+	quit, done chan struct{}
+}
+
+// WatchVModuleFile applies the vmodule spec contained in the file at path
+// and applies it again whenever the file changes, so per-module verbosity
+// can be tuned without a restart. Clauses in the file may be separated by
+// commas or whitespace such as newlines. Once watching has started, an
+// invalid spec is reported as a warning and leaves the previous one in
+// effect. Any previously watched file is no longer watched.
+func WatchVModuleFile(path string) error {
+	vmoduleWatch.Lock()
+	defer vmoduleWatch.Unlock()
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := loadVModuleFile(path); err != nil {
+		return err
+	}
+	stopWatching()
+	vmoduleWatch.quit, vmoduleWatch.done = make(chan struct{}), make(chan struct{})
+	go watchVModuleFile(path, fi, vmoduleWatch.quit, vmoduleWatch.done)
+	return nil
+}
+
+// StopWatching stops the watcher started by WatchVModuleFile. The spec
+// currently in effect is kept.
+func StopWatching() {
+	vmoduleWatch.Lock()
+	stopWatching()
+	vmoduleWatch.Unlock()
+}
+
+// stopWatching stops the watcher, if any, and waits for it to exit.
+// vmoduleWatch is locked.
+func stopWatching() {
+	if vmoduleWatch.quit != nil {
+		close(vmoduleWatch.quit)
+		<-vmoduleWatch.done
+		vmoduleWatch.quit, vmoduleWatch.done = nil, nil
+	}
+}
+
+// loadVModuleFile reads the file at path and applies it as vmodule spec.
+func loadVModuleFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	spec := strings.Join(strings.Fields(string(data)), ",")
+	return SetVModule(spec)
+}
+
+// watchVModuleFile polls the file at path and reloads it when its size or
+// modification time changes. A change is applied only once it has been
+// seen by two consecutive polls, so that a file which is still being
+// written is not loaded half-way.
+func watchVModuleFile(path string, last os.FileInfo, quit, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(vmoduleWatchInterval)
+	defer ticker.Stop()
+	var pending os.FileInfo
+	for {
+		select {
+		case <-ticker.C:
+			fi, err := os.Stat(path)
+			if err != nil {
+				// The file may be in the middle of being replaced.
+				pending = nil
+				continue
+			}
+			if sameFileState(fi, last) {
+				pending = nil
+				continue
+			}
+			if pending == nil || !sameFileState(fi, pending) {
+				pending = fi
+				continue
+			}
+			last, pending = fi, nil
+			if err := loadVModuleFile(path); err != nil {
+				Warningf("glog: cannot apply vmodule file %s: %v", path, err)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+// sameFileState reports whether a and b have the same size and
+// modification time.
+func sameFileState(a, b os.FileInfo) bool {
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
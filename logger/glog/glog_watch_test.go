@@ -0,0 +1,92 @@
+// Copyright 2017 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package glog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that the vmodule spec is reloaded when the watched file changes.
+func TestWatchVModuleFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous time.Duration) { vmoduleWatchInterval = previous }(vmoduleWatchInterval)
+	vmoduleWatchInterval = 10 * time.Millisecond
+	defer SetVModule("")
+	defer SetV(Verbosity())
+	defer StopWatching()
+	SetV(0)
+
+	path := filepath.Join(dir, "vmodule")
+	if err := WatchVModuleFile(path); err == nil {
+		t.Error("missing file accepted")
+	}
+	if err := ioutil.WriteFile(path, []byte("foo.go=1\nglog_watch_test.go=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WatchVModuleFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if !V(2) || V(3) {
+		t.Fatal("initial spec not applied")
+	}
+
+	waitFor := func(what string, cond func() bool) {
+		for deadline := time.Now().Add(5 * time.Second); !cond(); {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if err := ioutil.WriteFile(path, []byte("glog_watch_test.go=3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("reload", func() bool { return bool(V(3)) })
+
+	// An invalid spec is reported and leaves the previous one in effect.
+	if err := ioutil.WriteFile(path, []byte("glog_watch_test.go=x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("warning", func() bool {
+		logging.mu.Lock()
+		defer logging.mu.Unlock()
+		return contains(warningLog, "cannot apply vmodule file", t)
+	})
+	if !V(3) {
+		t.Error("invalid spec replaced the previous one")
+	}
+
+	StopWatching()
+	if err := ioutil.WriteFile(path, []byte("glog_watch_test.go=1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * vmoduleWatchInterval)
+	if !V(3) {
+		t.Error("file reloaded after StopWatching")
+	}
+	StopWatching() // no-op
+}